@@ -0,0 +1,809 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"ssh-ogm/internal/config"
+	"ssh-ogm/internal/ssh"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/x/term"
+)
+
+const usage = `Usage:
+  mux-ssh                                        Start the dashboard
+  mux-ssh add [-proxy] <alias> key=value...      Add a host
+  mux-ssh set [-proxy] <alias> <key> [value...]  Replace a key (no value removes it)
+  mux-ssh rm  [-proxy] <alias>                   Delete a host
+  mux-ssh mv  [-proxy] <alias> <new-alias>       Rename a host
+  mux-ssh secret set <name> [value]              Store a secret (prompts if value is omitted)
+  mux-ssh secret get <name>                      Print a secret
+  mux-ssh secret rm <name>                       Delete a secret
+  mux-ssh secret list                            List secret names
+  mux-ssh lint                                   Audit the inventory for insecure settings
+  mux-ssh config explain <alias>                 Show which layer each value of a host comes from
+  mux-ssh import ansible <inventory>             Add the hosts of an Ansible INI or YAML inventory
+  mux-ssh export [-format <format>]              Print hosts as ansible, csv, markdown or json (default)
+  mux-ssh proxy-connect <proxy> <host> <port>    Tunnel stdin/stdout through a proxy (for ProxyCommand)
+  mux-ssh pin <alias>                            Fetch a server's host keys and pin their fingerprints
+  mux-ssh keyscan [-tag <tag>] [-yes] [alias...] Refresh known_hosts with the servers' current keys
+  mux-ssh inventory versions [-older-than <v>]   List the servers' SSH versions (also -tag, -product)
+`
+
+// runCommand executes the CLI subcommand named by args[0]
+func runCommand(mgr *config.Manager, args []string) error {
+	switch args[0] {
+	case "add":
+		return cmdAdd(mgr, args[1:])
+	case "set":
+		return cmdSet(mgr, args[1:])
+	case "rm":
+		return cmdRemove(mgr, args[1:])
+	case "mv":
+		return cmdRename(mgr, args[1:])
+	case "secret":
+		return cmdSecret(mgr, args[1:])
+	case "lint":
+		return cmdLint(mgr)
+	case "config":
+		return cmdConfig(mgr, args[1:])
+	case "import":
+		return cmdImport(mgr, args[1:])
+	case "export":
+		return cmdExport(mgr, args[1:])
+	case "proxy-connect":
+		return cmdProxyConnect(mgr, args[1:])
+	case "pin":
+		return cmdPin(mgr, args[1:])
+	case "keyscan":
+		return cmdKeyscan(mgr, args[1:])
+	case "inventory":
+		return cmdInventory(mgr, args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command '%s'", args[0])
+	}
+}
+
+// hostFlags parses the flags shared by the host editing commands and
+// returns the target file along with the positional arguments.
+func hostFlags(name string, args []string) (string, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	isProxy := fs.Bool("proxy", false, "edit proxies.conf instead of the server config")
+	if err := fs.Parse(args); err != nil {
+		return "", nil, err
+	}
+	if *isProxy {
+		return config.ProxiesName, fs.Args(), nil
+	}
+	return config.ConfigName, fs.Args(), nil
+}
+
+func cmdAdd(mgr *config.Manager, args []string) error {
+	filename, rest, err := hostFlags("add", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) < 1 {
+		return fmt.Errorf("usage: mux-ssh add [-proxy] <alias> key=value...")
+	}
+
+	h := config.HostConfig{Alias: rest[0]}
+	for _, pair := range rest[1:] {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got '%s'", pair)
+		}
+		if err := h.Set(key, value); err != nil {
+			return err
+		}
+	}
+	if h.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+
+	if err := mgr.AddHost(filename, h); err != nil {
+		return err
+	}
+	fmt.Printf("Added %s to %s\n", h.Alias, filename)
+	return nil
+}
+
+func cmdSet(mgr *config.Manager, args []string) error {
+	filename, rest, err := hostFlags("set", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) < 2 {
+		return fmt.Errorf("usage: mux-ssh set [-proxy] <alias> <key> [value...]")
+	}
+
+	if needsOverride(mgr, filename, rest[0]) {
+		// Hosts from the system or team layers get a personal override block
+		if err := mgr.AddHost(filename, config.HostConfig{Alias: rest[0]}); err != nil {
+			return err
+		}
+	}
+	if err := mgr.UpdateHost(filename, rest[0], rest[1], rest[2:]...); err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s.%s\n", rest[0], rest[1])
+	return nil
+}
+
+func cmdRemove(mgr *config.Manager, args []string) error {
+	filename, rest, err := hostFlags("rm", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("usage: mux-ssh rm [-proxy] <alias>")
+	}
+
+	if err := mgr.DeleteHost(filename, rest[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s from %s\n", rest[0], filename)
+	return nil
+}
+
+func cmdRename(mgr *config.Manager, args []string) error {
+	filename, rest, err := hostFlags("mv", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 2 {
+		return fmt.Errorf("usage: mux-ssh mv [-proxy] <alias> <new-alias>")
+	}
+
+	if err := mgr.RenameHost(filename, rest[0], rest[1]); err != nil {
+		return err
+	}
+	fmt.Printf("Renamed %s to %s\n", rest[0], rest[1])
+	return nil
+}
+
+func cmdSecret(mgr *config.Manager, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: mux-ssh secret set|get|rm|list")
+	}
+
+	vault, err := mgr.Vault()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "set":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("usage: mux-ssh secret set <name> [value]")
+		}
+		var value string
+		if len(args) == 3 {
+			value = args[2]
+		} else if value, err = readHidden(fmt.Sprintf("Value for %s: ", args[1])); err != nil {
+			return err
+		}
+		if err := vault.Set(args[1], value); err != nil {
+			return err
+		}
+		if err := vault.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Stored secret %s. Reference it as 'password: %s%s'\n", args[1], config.SecretPrefix, args[1])
+	case "get":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: mux-ssh secret get <name>")
+		}
+		value, ok := vault.Get(args[1])
+		if !ok {
+			return fmt.Errorf("secret '%s' not found", args[1])
+		}
+		fmt.Println(value)
+	case "rm":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: mux-ssh secret rm <name>")
+		}
+		if err := vault.Delete(args[1]); err != nil {
+			return err
+		}
+		if err := vault.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Removed secret %s\n", args[1])
+	case "list":
+		for _, name := range vault.Names() {
+			fmt.Println(name)
+		}
+	default:
+		return fmt.Errorf("unknown secret command '%s'", args[0])
+	}
+	return nil
+}
+
+// promptPassphrase reads the vault passphrase from the terminal
+func promptPassphrase(create bool) (string, error) {
+	if !create {
+		return readHidden("Vault passphrase: ")
+	}
+
+	fmt.Fprintln(os.Stderr, "Creating a new secrets vault.")
+	pass, err := readHidden("New vault passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", errors.New("passphrase must not be empty")
+	}
+	confirm, err := readHidden("Confirm passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass != confirm {
+		return "", errors.New("passphrases do not match")
+	}
+	return pass, nil
+}
+
+// readHidden prompts on stderr and reads a line from the terminal without echoing it
+func readHidden(prompt string) (string, error) {
+	if !term.IsTerminal(os.Stdin.Fd()) {
+		return "", errors.New("cannot prompt for input: stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func cmdLint(mgr *config.Manager) error {
+	inv, err := loadInventory(mgr)
+	if err != nil {
+		return err
+	}
+
+	findings := mgr.Lint(inv.Servers, inv.Proxies)
+	high := 0
+	for _, f := range findings {
+		fmt.Println(f)
+		if f.Severity == config.SeverityHigh {
+			high++
+		}
+	}
+	if len(findings) == 0 {
+		fmt.Println("No issues found.")
+	}
+	if high > 0 {
+		return fmt.Errorf("%d high severity finding(s)", high)
+	}
+	return nil
+}
+
+// needsOverride reports whether alias only exists in a layer below the personal files
+func needsOverride(mgr *config.Manager, filename, alias string) bool {
+	inv, err := loadInventory(mgr)
+	if err != nil {
+		return false
+	}
+	pick := func(l config.Layer) []config.HostConfig { return l.Servers }
+	if filename == config.ProxiesName {
+		pick = func(l config.Layer) []config.HostConfig { return l.Proxies }
+	}
+
+	found := false
+	for i, l := range inv.Layers {
+		for _, h := range pick(l) {
+			if h.Alias != alias {
+				continue
+			}
+			if i == len(inv.Layers)-1 {
+				// Already has a personal block
+				return false
+			}
+			found = true
+		}
+	}
+	return found
+}
+
+func cmdConfig(mgr *config.Manager, args []string) error {
+	if len(args) != 2 || args[0] != "explain" {
+		return fmt.Errorf("usage: mux-ssh config explain <alias>")
+	}
+
+	inv, err := loadInventory(mgr)
+	if err != nil {
+		return err
+	}
+	fields, isProxy, err := inv.Explain(args[1])
+	if err != nil {
+		return err
+	}
+
+	kind := "server"
+	if isProxy {
+		kind = "proxy"
+	}
+	var names []string
+	for _, l := range inv.Layers {
+		names = append(names, l.Name)
+	}
+	fmt.Printf("%s (%s), layers: %s\n\n", args[1], kind, strings.Join(names, " -> "))
+
+	for _, f := range fields {
+		for _, v := range f.Values {
+			if f.Key == "password" && !strings.HasPrefix(v, config.SecretPrefix) {
+				v = "(hidden)"
+			}
+			fmt.Printf("  %-18s %-40s %s\n", f.Key, v, f.Layer)
+		}
+	}
+	return nil
+}
+
+func cmdImport(mgr *config.Manager, args []string) error {
+	if len(args) != 2 || args[0] != "ansible" {
+		return fmt.Errorf("usage: mux-ssh import ansible <inventory>")
+	}
+
+	hosts, skipped, err := config.ImportAnsible(args[1])
+	if err != nil {
+		return err
+	}
+	for _, s := range skipped {
+		fmt.Printf("Ignored %s: uses a template\n", s)
+	}
+	existing, err := mgr.Load(config.ConfigName)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, h := range existing {
+		known[h.Alias] = true
+	}
+
+	added := 0
+	for _, h := range hosts {
+		if known[h.Alias] {
+			fmt.Printf("Skipped %s: already exists\n", h.Alias)
+			continue
+		}
+		if err := mgr.AddHost(config.ConfigName, h); err != nil {
+			return err
+		}
+		added++
+	}
+	fmt.Printf("Imported %d of %d host(s) into %s\n", added, len(hosts), config.ConfigName)
+	return nil
+}
+
+func cmdExport(mgr *config.Manager, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "json", "output format: "+strings.Join(config.ExportFormats, ", "))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("usage: mux-ssh export -format ansible|csv|markdown|json")
+	}
+
+	inv, err := loadInventory(mgr)
+	if err != nil {
+		return err
+	}
+	return config.Export(os.Stdout, *format, inv, mgr.LoadStatuses())
+}
+
+// cmdProxyConnect is used as ssh's ProxyCommand, so stdout carries the
+// tunnelled connection and must not be used for anything else. The runner
+// passes the proxy's settings as flags; run by hand, the proxy is looked up
+// in the inventory.
+func cmdProxyConnect(mgr *config.Manager, args []string) error {
+	var given config.HostConfig
+	fs := flag.NewFlagSet("proxy-connect", flag.ContinueOnError)
+	fs.StringVar(&given.Host, "host", "", "the proxy's host, skips the inventory lookup")
+	fs.StringVar(&given.Port, "port", "", "the proxy's port")
+	fs.StringVar(&given.Type, "type", "", "the proxy's type")
+	fs.StringVar(&given.User, "user", "", "the proxy's user")
+	fs.StringVar(&given.CABundle, "ca-bundle", "", "the proxy's ca_bundle")
+	passwordFile := fs.String("password-file", "", "file holding the proxy's password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+	if len(args) != 3 {
+		return fmt.Errorf("usage: mux-ssh proxy-connect <proxy> <host> <port>")
+	}
+
+	var err error
+	proxy := &given
+	proxy.Alias = args[0]
+	if given.Host == "" {
+		if proxy, err = findProxy(mgr, args[0]); err != nil {
+			return err
+		}
+	}
+
+	// mux-ssh resolved the password before starting ssh, since we can't ask
+	var password string
+	if *passwordFile != "" {
+		data, err := os.ReadFile(*passwordFile)
+		if err != nil {
+			return err
+		}
+		password = string(data)
+	} else if password, err = ssh.Password(*proxy); err != nil {
+		return err
+	}
+	conn, err := ssh.DialProxy(*proxy, password, net.JoinHostPort(args[1], args[2]), ssh.DialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, os.Stdin)
+		// Let the server see EOF while its output keeps flowing
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+	}()
+	_, err = io.Copy(os.Stdout, conn)
+	return err
+}
+
+// findProxy looks alias up in the merged proxies of every layer
+func findProxy(mgr *config.Manager, alias string) (*config.HostConfig, error) {
+	inv, err := mgr.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+	for i := range inv.Proxies {
+		if inv.Proxies[i].Alias == alias {
+			return &inv.Proxies[i], nil
+		}
+	}
+	return nil, fmt.Errorf("proxy '%s' not found", alias)
+}
+
+func cmdPin(mgr *config.Manager, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: mux-ssh pin <alias>")
+	}
+	alias := args[0]
+
+	inv, err := loadInventory(mgr)
+	if err != nil {
+		return err
+	}
+	host, proxy, err := findServer(inv, alias)
+	if err != nil {
+		return err
+	}
+	keys, err := ssh.ScanHostKeys(*host, proxy)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Host keys presented by %s (%s):\n", alias, host.Host)
+	var fingerprints []string
+	for _, k := range keys {
+		note := ""
+		if slices.Contains(host.HostKeys, k.Fingerprint) {
+			note = " (already pinned)"
+		}
+		fmt.Printf("  %-22s %s%s\n", k.Type, k.Fingerprint, note)
+		fingerprints = append(fingerprints, k.Fingerprint)
+	}
+	for _, pin := range host.HostKeys {
+		if !slices.Contains(fingerprints, pin) {
+			fmt.Printf("  %-22s %s (pinned, no longer presented, will be removed)\n", "", pin)
+		}
+	}
+	fmt.Println("Compare them with the server's own (ssh-keygen -lf /etc/ssh/ssh_host_*_key.pub) before confirming.")
+
+	answer, err := ssh.Prompt(fmt.Sprintf("Pin these keys for %s (yes/no)? ", alias), true)
+	if err != nil {
+		return err
+	}
+	if answer != "yes" {
+		fmt.Println("Nothing changed.")
+		return nil
+	}
+
+	if needsOverride(mgr, config.ConfigName, alias) {
+		if err := mgr.AddHost(config.ConfigName, config.HostConfig{Alias: alias}); err != nil {
+			return err
+		}
+	}
+	if err := mgr.UpdateHost(config.ConfigName, alias, "hostkey", fingerprints...); err != nil {
+		return err
+	}
+	fmt.Printf("Pinned %d key(s) for %s\n", len(fingerprints), alias)
+	return nil
+}
+
+func cmdKeyscan(mgr *config.Manager, args []string) error {
+	fs := flag.NewFlagSet("keyscan", flag.ContinueOnError)
+	tag := fs.String("tag", "", "scan every server with this tag")
+	yes := fs.Bool("yes", false, "update known_hosts without asking")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 && *tag == "" {
+		return fmt.Errorf("usage: mux-ssh keyscan [-tag <tag>] [-yes] [alias...]")
+	}
+
+	inv, err := loadInventory(mgr)
+	if err != nil {
+		return err
+	}
+	var hosts []config.HostConfig
+	for _, alias := range fs.Args() {
+		if _, _, err := findServer(inv, alias); err != nil {
+			return err
+		}
+	}
+	for _, h := range inv.Servers {
+		if slices.Contains(fs.Args(), h.Alias) || (*tag != "" && slices.Contains(h.Tags, *tag)) {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return noServersError(*tag)
+	}
+
+	var updates []ssh.HostKeyUpdate
+	for _, h := range hosts {
+		if len(h.HostKeys) > 0 {
+			fmt.Printf("%s: skipped, uses pinned host keys (see 'mux-ssh pin')\n", h.Alias)
+			continue
+		}
+		_, proxy, err := findServer(inv, h.Alias)
+		if err != nil {
+			fmt.Printf("%s: %v\n", h.Alias, err)
+			continue
+		}
+		scanned, err := ssh.ScanHostKeys(h, proxy)
+		if err != nil {
+			fmt.Printf("%s: %v\n", h.Alias, err)
+			continue
+		}
+		old, err := ssh.KnownHostKeys(h)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s (%s)\n", h.Alias, h.Host)
+		if printKeyChanges(old, scanned) {
+			updates = append(updates, ssh.HostKeyUpdate{Host: h, Keys: scanned})
+		}
+	}
+
+	if len(updates) == 0 {
+		fmt.Println("known_hosts is up to date.")
+		return nil
+	}
+	if !*yes {
+		answer, err := ssh.Prompt(fmt.Sprintf("Update %s for %d host(s) (yes/no)? ", ssh.KnownHostsPath, len(updates)), true)
+		if err != nil {
+			return err
+		}
+		if answer != "yes" {
+			fmt.Println("Nothing changed.")
+			return nil
+		}
+	}
+	removed, err := ssh.UpdateKnownHosts(updates)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Updated %d host(s), replacing %d old entries\n", len(updates), removed)
+	return nil
+}
+
+// maxParallelChecks bounds how many servers inventory reports check at once
+const maxParallelChecks = 16
+
+func cmdInventory(mgr *config.Manager, args []string) error {
+	const usage = "usage: mux-ssh inventory versions [-tag <tag>] [-product <name>] [-older-than <version>]"
+	if len(args) == 0 || args[0] != "versions" {
+		return errors.New(usage)
+	}
+	fs := flag.NewFlagSet("inventory versions", flag.ContinueOnError)
+	tag := fs.String("tag", "", "only check servers with this tag")
+	product := fs.String("product", "", "only list servers running this SSH implementation, e.g. OpenSSH")
+	olderThan := fs.String("older-than", "", "only list servers older than this version (of OpenSSH unless -product is given)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New(usage)
+	}
+	if *olderThan != "" && *product == "" {
+		*product = "OpenSSH"
+	}
+
+	inv, err := loadInventory(mgr)
+	if err != nil {
+		return err
+	}
+	var hosts []config.HostConfig
+	for _, h := range inv.Servers {
+		if *tag == "" || slices.Contains(h.Tags, *tag) {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return noServersError(*tag)
+	}
+
+	// Ask for the passwords checks log in with now, the checks below run in parallel
+	var logins []config.HostConfig
+	for _, p := range inv.Proxies {
+		if slices.ContainsFunc(hosts, func(h config.HostConfig) bool { return h.Proxy == p.Alias }) {
+			logins = append(logins, p)
+		}
+	}
+	for _, h := range hosts {
+		if h.AuthCheck && (h.Password != "" || h.PasswordCommand != "") {
+			logins = append(logins, h)
+		}
+	}
+	for _, h := range logins {
+		if _, err := ssh.Password(h); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	results := checkServers(inv, hosts)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tSERVER\tKEX\tCIPHER")
+	listed, unknown := 0, 0
+	for _, h := range results {
+		if h.Banner == "" {
+			unknown++
+			if *product == "" {
+				fmt.Fprintf(w, "%s\t(%s)\t\t\n", h.Alias, describeFailure(h))
+			}
+			continue
+		}
+		name, version, _ := ssh.ParseBanner(h.Banner)
+		if *product != "" && !strings.EqualFold(name, *product) {
+			continue
+		}
+		if *olderThan != "" && ssh.CompareVersions(version, *olderThan) >= 0 {
+			continue
+		}
+		kex, cipher := "", ""
+		if h.Algorithms != nil {
+			kex, cipher = h.Algorithms.KeyExchange, h.Algorithms.Cipher
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", h.Alias, strings.TrimPrefix(h.Banner, "SSH-2.0-"), kex, cipher)
+		listed++
+	}
+	w.Flush()
+
+	if *product != "" {
+		filter := *product
+		if *olderThan != "" {
+			filter += " older than " + *olderThan
+		}
+		fmt.Printf("\n%d of %d server(s) run %s\n", listed, len(results), filter)
+		if unknown > 0 {
+			fmt.Printf("%d server(s) could not be checked, their version is unknown\n", unknown)
+		}
+	}
+	return nil
+}
+
+// checkServers checks hosts along their routes, a few at a time, and
+// returns the results in the order of hosts.
+func checkServers(inv *config.Inventory, hosts []config.HostConfig) []ssh.ServerHealth {
+	results := make([]ssh.ServerHealth, len(hosts))
+	sem := make(chan struct{}, maxParallelChecks)
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		// A missing proxy is reported by the check itself
+		_, proxy, _ := findServer(inv, h.Alias)
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = ssh.CheckRoute(h, proxy)
+		})
+	}
+	wg.Wait()
+	return results
+}
+
+// describeFailure says in a few words why a check did not reach the server
+func describeFailure(h ssh.ServerHealth) string {
+	if h.Class != "" {
+		return fmt.Sprintf("%s, %s", h.Status, h.Class)
+	}
+	return h.Status.String()
+}
+
+// printKeyChanges lists the known and scanned keys of a host side by side
+// and reports whether known_hosts needs updating.
+func printKeyChanges(old []ssh.KnownHostKey, scanned []ssh.ScannedKey) bool {
+	changed := false
+	for _, k := range old {
+		if slices.ContainsFunc(scanned, func(s ssh.ScannedKey) bool { return s.Fingerprint == k.Fingerprint }) {
+			fmt.Printf("  = %-22s %s\n", k.Type, k.Fingerprint)
+			continue
+		}
+		fmt.Printf("  - %-22s %s (line %d)\n", k.Type, k.Fingerprint, k.Line)
+		changed = true
+	}
+	for _, k := range scanned {
+		if !slices.ContainsFunc(old, func(o ssh.KnownHostKey) bool { return o.Fingerprint == k.Fingerprint }) {
+			fmt.Printf("  + %-22s %s\n", k.Type, k.Fingerprint)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// noServersError explains why a command selecting servers by tag, or all
+// of them without one, found nothing
+func noServersError(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("no servers in the inventory")
+	}
+	return fmt.Errorf("no servers tagged '%s'", tag)
+}
+
+// findServer returns the server alias and the proxy it connects through, if any
+func findServer(inv *config.Inventory, alias string) (*config.HostConfig, *config.HostConfig, error) {
+	var host *config.HostConfig
+	for i := range inv.Servers {
+		if inv.Servers[i].Alias == alias {
+			host = &inv.Servers[i]
+		}
+	}
+	if host == nil {
+		return nil, nil, fmt.Errorf("server '%s' not found", alias)
+	}
+	if host.Proxy == "" {
+		return host, nil, nil
+	}
+	for i := range inv.Proxies {
+		if inv.Proxies[i].Alias == host.Proxy {
+			return host, &inv.Proxies[i], nil
+		}
+	}
+	return nil, nil, fmt.Errorf("proxy '%s' of %s not found in proxies.conf", host.Proxy, alias)
+}
+
+// loadInventory loads every layer, waiting for inventory commands whose
+// cached output is out of date. Source warnings are printed to stderr.
+func loadInventory(mgr *config.Manager) (*config.Inventory, error) {
+	inv, err := mgr.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+	if len(inv.Stale) > 0 {
+		warnings := mgr.RefreshSources(inv.Stale)
+		if inv, err = mgr.LoadInventory(); err != nil {
+			return nil, err
+		}
+		inv.Warnings = append(inv.Warnings, warnings...)
+	}
+	for _, w := range inv.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	return inv, nil
+}
@@ -6,6 +6,7 @@ import (
 	"ssh-ogm/internal/config"
 	"ssh-ogm/internal/ssh"
 	"ssh-ogm/internal/tui"
+	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -17,6 +18,8 @@ func main() {
 		fmt.Printf("Error initializing config manager: %v\n", err)
 		os.Exit(1)
 	}
+	mgr.Passphrase = promptPassphrase
+	ssh.SecretLookup = mgr.ResolveSecret
 
 	// Check/Create Config
 	isFirstRun, err := mgr.Initialize()
@@ -25,6 +28,16 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Subcommands work on the files directly and skip the TUI
+	if len(os.Args) > 1 {
+		if err := runCommand(mgr, os.Args[1:]); err != nil {
+			// stderr, since proxy-connect's stdout belongs to ssh
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if isFirstRun {
 		// Run First Run TUI
 		p := tea.NewProgram(tui.NewFirstRunModel(mgr.GetConfigPath()))
@@ -48,44 +61,55 @@ func main() {
 		}
 	}
 
-	// Parse Server Config
-	f, err := os.Open(mgr.GetConfigPath())
+	// Load servers and proxies from every layer
+	inv, err := mgr.LoadInventory()
 	if err != nil {
-		fmt.Printf("Error opening config: %v\n", err)
+		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
-	defer f.Close()
+	configs, proxies := inv.Servers, inv.Proxies
 
-	configs, err := config.Parse(f)
-	if err != nil {
-		fmt.Printf("Error parsing config: %v\n", err)
-		os.Exit(1)
+	// Health checks log in to proxies, and to servers with auth_check, and
+	// the dashboard can't ask for the vault passphrase once it owns the
+	// terminal, so unlock it up front
+	needsVault := false
+	for _, p := range proxies {
+		needsVault = needsVault || strings.HasPrefix(p.Password, config.SecretPrefix)
 	}
-
-	// Parse Proxy Config
-	pf, err := os.Open(mgr.GetProxiesPath())
-	if err != nil {
-		fmt.Printf("Error opening proxies config: %v\n", err)
-		os.Exit(1)
+	for _, c := range configs {
+		needsVault = needsVault || c.AuthCheck && strings.HasPrefix(c.Password, config.SecretPrefix)
 	}
-	defer pf.Close()
-
-	proxies, err := config.Parse(pf)
-	if err != nil {
-		fmt.Printf("Error parsing proxies config: %v\n", err)
-		os.Exit(1)
+	if needsVault {
+		if _, err := mgr.Vault(); err != nil {
+			fmt.Printf("Warning: vault not unlocked, hosts whose password is stored in it can't be checked: %v\n", err)
+		}
 	}
+	mgr.Passphrase = nil
 
 	// Start Dashboard
-	p := tea.NewProgram(tui.NewDashboardModel(configs, proxies, mgr))
+	model := tui.NewDashboardModel(configs, proxies, mgr)
+	model.Warnings = inv.Warnings
+	model.StaleSources = inv.Stale
+	p := tea.NewProgram(model)
 	m, err := p.Run()
 	if err != nil {
 		fmt.Printf("Error running dashboard: %v\n", err)
 		os.Exit(1)
 	}
 
-	if dashboard, ok := m.(tui.DashboardModel); ok && dashboard.Selected != nil {
+	mgr.Passphrase = promptPassphrase
+
+	dashboard, ok := m.(tui.DashboardModel)
+	if ok {
+		// Failing to remember the statuses only affects exports
+		dashboard.SaveStatuses()
+	}
+	if ok && dashboard.Selected != nil {
 		fmt.Printf("Connecting to %s...\n", dashboard.Selected.Alias)
+		if dashboard.Plain {
+			dashboard.Selected.Command = ""
+			dashboard.Selected.Cwd = ""
+		}
 		
 		// Find Proxy
 		var proxyCfg *config.HostConfig
@@ -107,6 +131,7 @@ func main() {
 		}
 
 		err := ssh.Connect(*dashboard.Selected, proxyCfg)
+		ssh.Cleanup()
 		if err != nil {
 			fmt.Printf("Error connecting: %v\n", err)
 			os.Exit(1)
@@ -0,0 +1,511 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ansibleInventory is the parsed form of an INI or YAML inventory
+type ansibleInventory struct {
+	hosts  []string                     // in order of first appearance
+	vars   map[string]map[string]string // host -> inventory vars
+	groups map[string]*ansibleGroup
+}
+
+type ansibleGroup struct {
+	hosts    []string
+	children []string
+	vars     map[string]string
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{
+		vars:   make(map[string]map[string]string),
+		groups: make(map[string]*ansibleGroup),
+	}
+}
+
+func (inv *ansibleInventory) group(name string) *ansibleGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &ansibleGroup{vars: make(map[string]string)}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+func (inv *ansibleInventory) addHost(group, host string, vars map[string]string) {
+	host, port := splitAnsibleAddress(host)
+	if _, ok := inv.vars[host]; !ok {
+		inv.hosts = append(inv.hosts, host)
+		inv.vars[host] = make(map[string]string)
+	}
+	if port != "" {
+		inv.vars[host]["ansible_port"] = port
+	}
+	for k, v := range vars {
+		inv.vars[host][k] = v
+	}
+	g := inv.group(group)
+	if !slices.Contains(g.hosts, host) {
+		g.hosts = append(g.hosts, host)
+	}
+}
+
+// ImportAnsible converts an Ansible INI or YAML inventory into servers.
+// ansible_host, ansible_user, ansible_port and ansible_ssh_private_key_file
+// are mapped to the matching fields, group membership becomes tags, and
+// group_vars/ and host_vars/ next to the inventory are honoured.
+// Templated values can't be evaluated, so those fields are left out and
+// returned in skipped as "host: var".
+func ImportAnsible(path string) (configs []HostConfig, skipped []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var inv *ansibleInventory
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		inv, err = parseAnsibleYAML(data)
+	default:
+		inv, err = parseAnsibleINI(string(data))
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	for name, g := range inv.groups {
+		vars, err := readVarsDir(filepath.Join(dir, "group_vars"), name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range vars {
+			g.vars[k] = v
+		}
+	}
+
+	// Every group a host belongs to, directly or through children
+	memberOf := make(map[string][]string)
+	var walk func(group string, seen map[string]bool) []string
+	walk = func(group string, seen map[string]bool) []string {
+		if seen[group] {
+			return nil
+		}
+		seen[group] = true
+		g := inv.groups[group]
+		hosts := append([]string{}, g.hosts...)
+		for _, child := range g.children {
+			if _, ok := inv.groups[child]; ok {
+				hosts = append(hosts, walk(child, seen)...)
+			}
+		}
+		return hosts
+	}
+	for name := range inv.groups {
+		for _, h := range walk(name, make(map[string]bool)) {
+			if !slices.Contains(memberOf[h], name) {
+				memberOf[h] = append(memberOf[h], name)
+			}
+		}
+	}
+
+	depth := groupDepths(inv)
+	for _, host := range inv.hosts {
+		groups := memberOf[host]
+		// Parents first so more specific groups win, like Ansible does
+		sort.Slice(groups, func(i, j int) bool {
+			if depth[groups[i]] != depth[groups[j]] {
+				return depth[groups[i]] < depth[groups[j]]
+			}
+			return groups[i] < groups[j]
+		})
+
+		vars := make(map[string]string)
+		for k, v := range inv.groups["all"].vars {
+			vars[k] = v
+		}
+		for _, g := range groups {
+			for k, v := range inv.groups[g].vars {
+				vars[k] = v
+			}
+		}
+		for k, v := range inv.vars[host] {
+			vars[k] = v
+		}
+		hostVars, err := readVarsDir(filepath.Join(dir, "host_vars"), host)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range hostVars {
+			vars[k] = v
+		}
+
+		h, templated, err := ansibleHost(host, vars)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, v := range templated {
+			skipped = append(skipped, host+": "+v)
+		}
+		for _, g := range groups {
+			if g != "all" && g != "ungrouped" {
+				h.Set("tags", g)
+			}
+		}
+		configs = append(configs, h)
+	}
+	return configs, skipped, nil
+}
+
+// splitAnsibleAddress splits the port off host names written the way
+// Ansible allows, db:5309 or [2001:db8::1]:2222. Bare IPv6 addresses are
+// returned as they are.
+func splitAnsibleAddress(name string) (host, port string) {
+	if rest, ok := strings.CutPrefix(name, "["); ok {
+		if addr, after, ok := strings.Cut(rest, "]"); ok {
+			if p, ok := strings.CutPrefix(after, ":"); ok && isPort(p) {
+				return addr, p
+			}
+			if after == "" {
+				return addr, ""
+			}
+		}
+		return name, ""
+	}
+	if h, p, ok := strings.Cut(name, ":"); ok && !strings.Contains(p, ":") && isPort(p) {
+		return h, p
+	}
+	return name, ""
+}
+
+func isPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// ansibleAlias turns a host name into an alias, replacing the characters
+// aliases can't hold, like the colons of IPv6 addresses, with '-'
+func ansibleAlias(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune("{}:# \t\r\n", r) {
+			return '-'
+		}
+		return r
+	}, name)
+}
+
+// ansibleHost maps the connection variables of an inventory host and
+// returns the names of the ones left out because they use templates.
+func ansibleHost(name string, vars map[string]string) (h HostConfig, templated []string, err error) {
+	h = HostConfig{Alias: ansibleAlias(name), Host: name}
+	if err := validateAlias(h.Alias); err != nil {
+		return h, nil, err
+	}
+	for _, keys := range []struct {
+		field string
+		vars  []string
+	}{
+		{"host", []string{"ansible_host", "ansible_ssh_host"}},
+		{"user", []string{"ansible_user", "ansible_ssh_user"}},
+		{"port", []string{"ansible_port", "ansible_ssh_port"}},
+		{"identity", []string{"ansible_ssh_private_key_file", "ansible_private_key_file"}},
+	} {
+		for _, v := range keys.vars {
+			if value, ok := vars[v]; ok && value != "" {
+				if strings.Contains(value, "{{") {
+					// Jinja templates can't be evaluated outside Ansible
+					templated = append(templated, v)
+				} else {
+					h.Set(keys.field, value)
+				}
+				break
+			}
+		}
+	}
+	return h, templated, nil
+}
+
+// groupDepths returns how far each group is from "all" so child group vars
+// can override their parents'.
+func groupDepths(inv *ansibleInventory) map[string]int {
+	depth := map[string]int{"all": 0}
+	var visit func(name string, d int)
+	visit = func(name string, d int) {
+		if cur, ok := depth[name]; ok && cur >= d && name != "all" {
+			return
+		}
+		if d > len(inv.groups) {
+			return // cycle
+		}
+		depth[name] = d
+		for _, child := range inv.groups[name].children {
+			if _, ok := inv.groups[child]; ok {
+				visit(child, d+1)
+			}
+		}
+	}
+	for name := range inv.groups {
+		if _, ok := depth[name]; !ok {
+			visit(name, 1)
+		}
+	}
+	return depth
+}
+
+// parseAnsibleINI reads the classic INI inventory format
+func parseAnsibleINI(data string) (*ansibleInventory, error) {
+	inv := newAnsibleInventory()
+	inv.group("all")
+	section, kind := "ungrouped", "hosts"
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section, kind = strings.Trim(line, "[]"), "hosts"
+			if name, suffix, ok := strings.Cut(section, ":"); ok {
+				section, kind = name, suffix
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: unknown section type '%s'", lineNum, kind)
+			}
+			inv.group(section)
+			continue
+		}
+
+		fields := splitINIFields(line)
+		switch kind {
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key=value", lineNum)
+			}
+			inv.group(section).vars[strings.TrimSpace(k)] = unquote(strings.TrimSpace(v))
+		case "children":
+			inv.group(fields[0])
+			g := inv.group(section)
+			if !slices.Contains(g.children, fields[0]) {
+				g.children = append(g.children, fields[0])
+			}
+		default:
+			vars := make(map[string]string)
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok {
+					return nil, fmt.Errorf("line %d: expected key=value, got '%s'", lineNum, f)
+				}
+				vars[k] = unquote(v)
+			}
+			for _, host := range expandHostPattern(fields[0]) {
+				inv.addHost(section, host, vars)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	linkAll(inv)
+	return inv, nil
+}
+
+// splitINIFields splits on whitespace, keeping quoted values together
+func splitINIFields(line string) []string {
+	var fields []string
+	var cur strings.Builder
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			cur.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			cur.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if cur.Len() > 0 {
+				fields = append(fields, cur.String())
+				cur.Reset()
+			}
+		case r == '#' && cur.Len() == 0:
+			return fields
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// expandHostPattern expands numeric ranges such as web[01:03].example.com
+func expandHostPattern(pattern string) []string {
+	open := strings.Index(pattern, "[")
+	end := strings.Index(pattern, "]")
+	if open < 0 || end < open {
+		return []string{pattern}
+	}
+	from, to, ok := strings.Cut(pattern[open+1:end], ":")
+	start, err1 := strconv.Atoi(from)
+	stop, err2 := strconv.Atoi(to)
+	if !ok || err1 != nil || err2 != nil || stop < start {
+		return []string{pattern}
+	}
+
+	var hosts []string
+	for i := start; i <= stop; i++ {
+		n := strconv.Itoa(i)
+		for len(n) < len(from) {
+			n = "0" + n // keep zero padding
+		}
+		for _, rest := range expandHostPattern(pattern[end+1:]) {
+			hosts = append(hosts, pattern[:open]+n+rest)
+		}
+	}
+	return hosts
+}
+
+// parseAnsibleYAML reads the YAML inventory format
+func parseAnsibleYAML(data []byte) (*ansibleInventory, error) {
+	var root map[string]yamlGroup
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	inv := newAnsibleInventory()
+	inv.group("all")
+	var load func(name string, g yamlGroup)
+	load = func(name string, g yamlGroup) {
+		group := inv.group(name)
+		for k, v := range g.Vars {
+			group.vars[k] = yamlScalar(v)
+		}
+		// Sort for a stable order; YAML mappings are unordered once decoded
+		for _, host := range sortedKeys(g.Hosts) {
+			vars := make(map[string]string)
+			for k, v := range g.Hosts[host] {
+				vars[k] = yamlScalar(v)
+			}
+			inv.addHost(name, host, vars)
+		}
+		for _, child := range sortedKeys(g.Children) {
+			if !slices.Contains(group.children, child) {
+				group.children = append(group.children, child)
+			}
+			load(child, g.Children[child])
+		}
+	}
+	for _, name := range sortedKeys(root) {
+		load(name, root[name])
+	}
+
+	linkAll(inv)
+	return inv, nil
+}
+
+type yamlGroup struct {
+	Hosts    map[string]map[string]any `yaml:"hosts"`
+	Vars     map[string]any            `yaml:"vars"`
+	Children map[string]yamlGroup      `yaml:"children"`
+}
+
+func yamlScalar(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// linkAll makes every top level group a child of "all"
+func linkAll(inv *ansibleInventory) {
+	isChild := make(map[string]bool)
+	for _, g := range inv.groups {
+		for _, c := range g.children {
+			isChild[c] = true
+		}
+	}
+	all := inv.group("all")
+	for _, name := range sortedKeys(inv.groups) {
+		if name != "all" && !isChild[name] && !slices.Contains(all.children, name) {
+			all.children = append(all.children, name)
+		}
+	}
+}
+
+// readVarsDir reads group_vars/<name>(.yml|.yaml) or every file in
+// group_vars/<name>/, the same lookup Ansible does for host_vars.
+func readVarsDir(dir, name string) (map[string]string, error) {
+	vars := make(map[string]string)
+	var files []string
+	for _, candidate := range []string{name, name + ".yml", name + ".yaml"} {
+		path := filepath.Join(dir, candidate)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				if !e.IsDir() {
+					files = append(files, filepath.Join(path, e.Name()))
+				}
+			}
+		} else {
+			files = append(files, path)
+		}
+	}
+
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var doc map[string]any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			// Vault encrypted files and the like are not ours to read
+			continue
+		}
+		for k, v := range doc {
+			vars[k] = yamlScalar(v)
+		}
+	}
+	return vars, nil
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImportAnsibleINI(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"hosts.ini": `
+bastion ansible_host=203.0.113.5
+legacy.example.com:5309
+2001:db8::7
+[2001:db8::8]:2222
+
+[web]
+web[01:02].example.com ansible_user=deploy
+
+[db]
+db1 ansible_host=10.0.0.10 ansible_port=2222
+
+[prod:children]
+web
+db
+
+[prod:vars]
+ansible_user=admin
+ansible_ssh_private_key_file=~/.ssh/prod
+`,
+		"group_vars/db.yml": "ansible_user: postgres\n",
+		"host_vars/db1.yml": "ansible_port: 2200\n",
+	})
+
+	hosts, _, err := ImportAnsible(filepath.Join(dir, "hosts.ini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	byAlias := make(map[string]HostConfig)
+	var aliases []string
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+		aliases = append(aliases, h.Alias)
+	}
+	want := []string{"bastion", "legacy.example.com", "2001-db8--7", "2001-db8--8", "web01.example.com", "web02.example.com", "db1"}
+	if !slices.Equal(aliases, want) {
+		t.Fatalf("aliases = %q, want %q", aliases, want)
+	}
+
+	if h := byAlias["bastion"]; h.Host != "203.0.113.5" || len(h.Tags) != 0 {
+		t.Errorf("bastion = %+v", h)
+	}
+	// Ports in host names, and IPv6 addresses, which aliases can't hold
+	if h := byAlias["legacy.example.com"]; h.Host != "legacy.example.com" || h.Port != "5309" {
+		t.Errorf("legacy = %+v", h)
+	}
+	if h := byAlias["2001-db8--7"]; h.Host != "2001:db8::7" || h.Port != "" {
+		t.Errorf("bare IPv6 = %+v", h)
+	}
+	if h := byAlias["2001-db8--8"]; h.Host != "2001:db8::8" || h.Port != "2222" {
+		t.Errorf("bracketed IPv6 = %+v", h)
+	}
+	// Host vars beat the parent group's vars
+	web := byAlias["web01.example.com"]
+	if web.Host != "web01.example.com" || web.User != "deploy" || web.IdentityFile != "~/.ssh/prod" {
+		t.Errorf("web01 = %+v", web)
+	}
+	if !slices.Equal(web.Tags, []string{"prod", "web"}) {
+		t.Errorf("web01 tags = %q", web.Tags)
+	}
+	// group_vars of the child group beat [prod:vars], host_vars beat inline vars
+	db := byAlias["db1"]
+	if db.Host != "10.0.0.10" || db.User != "postgres" || db.Port != "2200" {
+		t.Errorf("db1 = %+v", db)
+	}
+}
+
+func TestImportAnsibleYAML(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"inventory.yml": `
+all:
+  vars:
+    ansible_user: ops
+  children:
+    staging:
+      hosts:
+        app-1:
+          ansible_host: 10.1.0.1
+          ansible_port: 2022
+        app-2:
+`,
+	})
+
+	hosts, _, err := ImportAnsible(filepath.Join(dir, "inventory.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %+v", hosts)
+	}
+	app := hosts[0]
+	if app.Alias != "app-1" || app.Host != "10.1.0.1" || app.Port != "2022" || app.User != "ops" {
+		t.Errorf("app-1 = %+v", app)
+	}
+	if !slices.Equal(app.Tags, []string{"staging"}) {
+		t.Errorf("app-1 tags = %q", app.Tags)
+	}
+	if hosts[1].Host != "app-2" {
+		t.Errorf("app-2 should default host to its name, got %+v", hosts[1])
+	}
+}
+
+func TestAnsibleSource(t *testing.T) {
+	m := newTestManager(t)
+	inventory := filepath.Join(m.HomeDir, "hosts.ini")
+	writeFiles(t, m.HomeDir, map[string]string{"hosts.ini": "[web]\nweb-1 ansible_host=10.0.0.1\n"})
+	os.WriteFile(m.GetSourcesPath(), []byte("ops {\n    ansible: "+inventory+"\n}\n"), 0600)
+
+	inv, err := m.LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Servers) != 1 || inv.Servers[0].Host != "10.0.0.1" || inv.Servers[0].Tags[0] != "web" {
+		t.Fatalf("unexpected servers: %+v (warnings %q)", inv.Servers, inv.Warnings)
+	}
+}
+
+func TestAnsibleTemplatedVars(t *testing.T) {
+	m := newTestManager(t)
+	inventory := filepath.Join(m.HomeDir, "hosts.ini")
+	writeFiles(t, m.HomeDir, map[string]string{"hosts.ini": `
+web-1 ansible_host=10.0.0.1 ansible_user="{{ deploy_user }}"
+web-2 ansible_host=10.0.0.2
+`})
+	os.WriteFile(m.GetSourcesPath(), []byte("ops {\n    ansible: "+inventory+"\n}\n"), 0600)
+
+	// Only the templated field is left out, the rest of the layer still loads
+	inv, err := m.LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Servers) != 2 || inv.Servers[0].Host != "10.0.0.1" || inv.Servers[0].User != "" || inv.Servers[1].Host != "10.0.0.2" {
+		t.Fatalf("unexpected servers: %+v", inv.Servers)
+	}
+	if len(inv.Warnings) != 1 || !strings.Contains(inv.Warnings[0], "web-1: ansible_user") {
+		t.Errorf("warnings = %q", inv.Warnings)
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Check kinds selectable with the check key
+const (
+	CheckSSH     = "ssh"     // SSH handshake up to the login prompt, the default
+	CheckTCP     = "tcp"     // TCP connect, to the host's port or another one
+	CheckICMP    = "icmp"    // ping, always direct
+	CheckHTTP    = "http"    // GET a URL and compare the status code
+	CheckCommand = "command" // local command, Nagios-style exit codes
+)
+
+// How the results of several checks combine, set with check_mode
+const (
+	CheckModeAll = "all" // Every check must pass, the default
+	CheckModeAny = "any" // One passing check is enough
+)
+
+// CheckSpec is a parsed check value
+type CheckSpec struct {
+	Kind    string
+	Port    string // tcp: the port to connect to, the host's port if empty
+	URL     string // http: the URL to GET
+	Status  int    // http: the expected status code
+	Command string // command: run through the shell
+}
+
+// ParseCheck parses a check value: "ssh", "tcp [port]", "icmp",
+// "http <url> [status]" or "command <command line>".
+func ParseCheck(value string) (CheckSpec, error) {
+	kind, rest, _ := strings.Cut(strings.TrimSpace(value), " ")
+	rest = strings.TrimSpace(rest)
+	args := strings.Fields(rest)
+	spec := CheckSpec{Kind: kind}
+
+	switch kind {
+	case CheckSSH, CheckICMP:
+		if len(args) > 0 {
+			return spec, fmt.Errorf("invalid check '%s': %s takes no arguments", value, kind)
+		}
+	case CheckTCP:
+		if len(args) > 1 {
+			return spec, fmt.Errorf("invalid check '%s': expected tcp [port]", value)
+		}
+		if len(args) == 1 {
+			if n, err := strconv.Atoi(args[0]); err != nil || n < 1 || n > 65535 {
+				return spec, fmt.Errorf("invalid check '%s': bad port '%s'", value, args[0])
+			}
+			spec.Port = args[0]
+		}
+	case CheckHTTP:
+		if len(args) == 0 || len(args) > 2 {
+			return spec, fmt.Errorf("invalid check '%s': expected http <url> [status]", value)
+		}
+		u, err := url.Parse(args[0])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return spec, fmt.Errorf("invalid check '%s': expected an http:// or https:// URL", value)
+		}
+		spec.URL, spec.Status = args[0], 200
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 100 || n > 599 {
+				return spec, fmt.Errorf("invalid check '%s': bad status '%s'", value, args[1])
+			}
+			spec.Status = n
+		}
+	case CheckCommand:
+		if rest == "" {
+			return spec, fmt.Errorf("invalid check '%s': expected command <command line>", value)
+		}
+		spec.Command = rest
+	default:
+		return spec, fmt.Errorf("invalid check '%s': expected %s, %s, %s, %s or %s",
+			value, CheckSSH, CheckTCP, CheckICMP, CheckHTTP, CheckCommand)
+	}
+	return spec, nil
+}
+
+// isCommandCheck reports whether key and value select a command check.
+// Those run arbitrary local commands unattended, so only local files may
+// set them.
+func isCommandCheck(key, value string) bool {
+	if key != "check" {
+		return false
+	}
+	spec, err := ParseCheck(value)
+	return err == nil && spec.Kind == CheckCommand
+}
+
+// String renders s the way it is written in a check value
+func (s CheckSpec) String() string {
+	switch s.Kind {
+	case CheckTCP:
+		if s.Port != "" {
+			return s.Kind + " " + s.Port
+		}
+	case CheckHTTP:
+		if s.Status != 200 {
+			return fmt.Sprintf("%s %s %d", s.Kind, s.URL, s.Status)
+		}
+		return s.Kind + " " + s.URL
+	case CheckCommand:
+		return s.Kind + " " + s.Command
+	}
+	return s.Kind
+}
@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestParseCheck(t *testing.T) {
+	valid := []struct {
+		value string
+		want  CheckSpec
+		str   string
+	}{
+		{"ssh", CheckSpec{Kind: CheckSSH}, "ssh"},
+		{"tcp", CheckSpec{Kind: CheckTCP}, "tcp"},
+		{"tcp 8443", CheckSpec{Kind: CheckTCP, Port: "8443"}, "tcp 8443"},
+		{"icmp", CheckSpec{Kind: CheckICMP}, "icmp"},
+		{"http https://web.example.com/healthz", CheckSpec{Kind: CheckHTTP, URL: "https://web.example.com/healthz", Status: 200}, "http https://web.example.com/healthz"},
+		{"http  http://10.0.0.5:8080/ 204", CheckSpec{Kind: CheckHTTP, URL: "http://10.0.0.5:8080/", Status: 204}, "http http://10.0.0.5:8080/ 204"},
+		{"command pg_isready -h db1 -t 3", CheckSpec{Kind: CheckCommand, Command: "pg_isready -h db1 -t 3"}, "command pg_isready -h db1 -t 3"},
+	}
+	for _, tt := range valid {
+		spec, err := ParseCheck(tt.value)
+		if err != nil {
+			t.Errorf("ParseCheck(%q): %v", tt.value, err)
+			continue
+		}
+		if spec != tt.want || spec.String() != tt.str {
+			t.Errorf("ParseCheck(%q) = %+v (%q)", tt.value, spec, spec.String())
+		}
+	}
+
+	for _, value := range []string{"", "smtp", "ssh 22", "tcp http", "tcp 70000", "tcp 80 443", "http", "http ftp://x/", "http /healthz", "http https://x/ ok", "http https://x/ 99", "command"} {
+		if _, err := ParseCheck(value); err == nil {
+			t.Errorf("ParseCheck(%q) should fail", value)
+		}
+	}
+}
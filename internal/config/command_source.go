@@ -0,0 +1,234 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultInventoryTimeout bounds an inventory_command without its own timeout
+const DefaultInventoryTimeout = 30 * time.Second
+
+// CommandInventory is the JSON document an inventory_command prints on stdout.
+// Each host is an object using the same keys as the config files, e.g.
+//
+//	{"servers": [{"alias": "web-1", "host": "10.0.0.1", "user": "deploy", "port": 22,
+//	              "env": ["DEPLOY_ENV=prod"]}],
+//	 "proxies": [{"alias": "corp", "host": "proxy.local", "port": 1080, "type": "socks5"}]}
+//
+// Values may be strings, numbers, booleans (written as yes or no) or lists of
+// those for repeatable keys.
+type CommandInventory struct {
+	Servers []map[string]any `json:"servers"`
+	Proxies []map[string]any `json:"proxies"`
+}
+
+// InventoryKeys are the keys accepted from an inventory_command: the
+// RemoteKeys plus a few more that still only describe hosts. Its output is
+// no more trusted than a download, so command checks are refused too.
+var InventoryKeys = append(slices.Clone(RemoteKeys), "type", "env", "check", "check_mode")
+
+// commandCache is the last successful output of an inventory_command
+type commandCache struct {
+	Command string
+	Fetched time.Time
+	Output  []byte
+}
+
+// loadCommandLayer returns the hosts from src's cached output. stale is true
+// when the command has to run again; if there is no cache at all it runs now.
+func (m *Manager) loadCommandLayer(src SourceConfig) (layer *Layer, stale bool, warning string) {
+	cached := m.readCommandCache(src)
+	if cached == nil {
+		if err := m.runCommandSource(src); err != nil {
+			return nil, false, fmt.Sprintf("source %s: %v", src.Name, err)
+		}
+		if cached = m.readCommandCache(src); cached == nil {
+			return nil, false, fmt.Sprintf("source %s: failed to cache output", src.Name)
+		}
+	} else {
+		stale = src.Refresh == 0 || time.Since(cached.Fetched) >= src.Refresh
+	}
+
+	layer, skipped, err := parseCommandInventory(src.Name, cached.Output)
+	if err != nil {
+		return nil, stale, fmt.Sprintf("source %s: %v", src.Name, err)
+	}
+	if len(skipped) > 0 {
+		warning = fmt.Sprintf("source %s: ignored keys not allowed in inventory commands, only local files may set them (%s)", src.Name, strings.Join(skipped, ", "))
+	}
+	return layer, stale, warning
+}
+
+// RefreshSources re-runs the named inventory commands and updates their
+// caches. It returns a warning for every command that failed.
+func (m *Manager) RefreshSources(names []string) []string {
+	sources, err := m.LoadSources()
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var warnings []string
+	for _, src := range sources {
+		if src.Command == "" || !slices.Contains(names, src.Name) {
+			continue
+		}
+		if err := m.runCommandSource(src); err != nil {
+			warnings = append(warnings, fmt.Sprintf("source %s: %v", src.Name, err))
+		}
+	}
+	return warnings
+}
+
+// runCommandSource executes src's inventory_command and caches valid output
+func (m *Manager) runCommandSource(src SourceConfig) error {
+	timeout := src.Timeout
+	if timeout == 0 {
+		timeout = DefaultInventoryTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", src.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", src.Command)
+	}
+	// Relative scripts like ./list-hosts.sh live next to sources.conf
+	cmd.Dir = filepath.Join(m.HomeDir, DirName)
+	cmd.WaitDelay = time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("inventory_command timed out after %s", timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("inventory_command failed (%v): %s", err, msg)
+		}
+		return fmt.Errorf("inventory_command failed: %v", err)
+	}
+
+	// Don't let a broken run replace the last good inventory
+	if _, _, err := parseCommandInventory(src.Name, stdout.Bytes()); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(commandCache{Command: src.Command, Fetched: time.Now(), Output: stdout.Bytes()})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.GetCacheDir(), 0700); err != nil {
+		return err
+	}
+	return WriteFileAtomic(m.commandCachePath(src), data)
+}
+
+func (m *Manager) commandCachePath(src SourceConfig) string {
+	return filepath.Join(m.GetCacheDir(), src.Name+".command.json")
+}
+
+// readCommandCache returns the cached output for src, or nil
+func (m *Manager) readCommandCache(src SourceConfig) *commandCache {
+	data, err := os.ReadFile(m.commandCachePath(src))
+	if err != nil {
+		return nil
+	}
+	var c commandCache
+	if err := json.Unmarshal(data, &c); err != nil || c.Command != src.Command {
+		return nil
+	}
+	return &c
+}
+
+// parseCommandInventory converts the JSON output of an inventory_command into
+// a layer. Keys outside InventoryKeys are skipped and returned as
+// "alias: key", command checks as "alias: check ...".
+func parseCommandInventory(name string, output []byte) (*Layer, []string, error) {
+	var doc CommandInventory
+	if err := json.Unmarshal(output, &doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid inventory JSON: %w", err)
+	}
+
+	layer := &Layer{Name: name}
+	var skipped, more []string
+	var err error
+	if layer.Servers, skipped, err = hostsFromJSON(doc.Servers); err != nil {
+		return nil, nil, fmt.Errorf("servers: %w", err)
+	}
+	if layer.Proxies, more, err = hostsFromJSON(doc.Proxies); err != nil {
+		return nil, nil, fmt.Errorf("proxies: %w", err)
+	}
+	return layer, append(skipped, more...), nil
+}
+
+func hostsFromJSON(entries []map[string]any) ([]HostConfig, []string, error) {
+	var hosts []HostConfig
+	var skipped []string
+	for i, entry := range entries {
+		alias, _ := entry["alias"].(string)
+		if err := validateAlias(alias); err != nil {
+			return nil, nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+
+		h := HostConfig{Alias: alias}
+		for key, raw := range entry {
+			if key == "alias" {
+				continue
+			}
+			if !slices.Contains(InventoryKeys, key) && slices.Contains(Keys, key) {
+				skipped = append(skipped, alias+": "+key)
+				continue
+			}
+			values := []any{raw}
+			if list, ok := raw.([]any); ok {
+				values = list
+			}
+			for _, v := range values {
+				s, err := jsonScalar(v)
+				if err != nil {
+					return nil, nil, fmt.Errorf("%s: %s: %w", alias, key, err)
+				}
+				if isCommandCheck(key, s) {
+					skipped = append(skipped, alias+": check "+s)
+					continue
+				}
+				if err := h.Set(key, s); err != nil {
+					return nil, nil, fmt.Errorf("%s: %w", alias, err)
+				}
+			}
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, skipped, nil
+}
+
+// jsonScalar returns a JSON value the way it is written in config files
+func jsonScalar(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "yes", nil
+		}
+		return "no", nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
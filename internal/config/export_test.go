@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testExportInventory() *Inventory {
+	return &Inventory{
+		Servers: []HostConfig{
+			{Alias: "web", Host: "10.0.0.2", Port: "22", User: "deploy", Proxy: "corp", Tags: []string{"prod", "web-tier"}, Password: "hunter2"},
+			{Alias: "db", Host: "10.0.0.1", Owner: "team | data",
+				HostKeys: []string{"SHA256:" + strings.Repeat("A", 43), "SHA256:" + strings.Repeat("B", 43)},
+				Checks:   []string{"tcp 443", "icmp"}},
+		},
+		Proxies: []HostConfig{
+			{Alias: "corp", Host: "proxy.local", Port: "1080", Type: "socks5"},
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	checked := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	statuses := StatusCache{Servers: map[string]HostStatus{"web": {Status: "online", Checked: checked}}}
+
+	var buf bytes.Buffer
+	if err := Export(&buf, "csv", testExportInventory(), statuses); err != nil {
+		t.Fatal(err)
+	}
+	want := "alias,host,port,user,proxy,tags,description,owner,status,checked\n" +
+		"db,10.0.0.1,,,,,,team | data,unknown,\n" +
+		"web,10.0.0.2,22,deploy,corp,\"prod, web-tier\",,,online,2024-05-01T12:00:00Z\n"
+	if buf.String() != want {
+		t.Errorf("csv:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := Export(&buf, "markdown", testExportInventory(), statuses); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `| db | 10.0.0.1 |  |  |  |  |  | team \| data | unknown |  |`) {
+		t.Errorf("markdown row not escaped:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Export(&buf, "json", testExportInventory(), statuses); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct{ Servers, Proxies []map[string]any }
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Servers) != 2 || doc.Servers[0]["alias"] != "db" || len(doc.Proxies) != 1 {
+		t.Fatalf("unexpected json: %s", buf.String())
+	}
+	if _, ok := doc.Servers[1]["password"]; ok {
+		t.Error("plaintext password must not be exported")
+	}
+	if pins, ok := doc.Servers[0]["hostkey"].([]any); !ok || len(pins) != 2 {
+		t.Errorf("both host key pins should be exported: %v", doc.Servers[0]["hostkey"])
+	}
+	if checks, ok := doc.Servers[0]["check"].([]any); !ok || len(checks) != 2 {
+		t.Errorf("every check should be exported: %v", doc.Servers[0]["check"])
+	}
+
+	buf.Reset()
+	if err := Export(&buf, "ansible", testExportInventory(), statuses); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"web_tier:", "ansible_ssh_common_args: -o ProxyCommand=\"nc -x proxy.local:1080 %h %p\"", "mux_status: online"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("ansible output missing %q:\n%s", want, buf.String())
+		}
+	}
+
+	// The exported inventory imports back into the same hosts and groups
+	path := filepath.Join(t.TempDir(), "inventory.yml")
+	os.WriteFile(path, buf.Bytes(), 0600)
+	hosts, _, err := ImportAnsible(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts[1].Alias != "web" || hosts[1].User != "deploy" || !slices.Equal(hosts[1].Tags, []string{"prod", "web_tier"}) {
+		t.Errorf("round trip: %+v", hosts)
+	}
+
+	if err := Export(&buf, "xml", testExportInventory(), statuses); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestSaveStatusesMerges(t *testing.T) {
+	m := newTestManager(t)
+	if err := m.SaveStatuses(map[string]HostStatus{"a": {Status: "online"}, "b": {Status: "online"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SaveStatuses(map[string]HostStatus{"b": {Status: "offline"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	c := m.LoadStatuses()
+	if c.Servers["a"].Status != "online" || c.Servers["b"].Status != "offline" {
+		t.Errorf("unexpected statuses: %+v", c.Servers)
+	}
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// AddHost appends a block for h to the specified file
+func (m *Manager) AddHost(filename string, h HostConfig) error {
+	if err := validateAlias(h.Alias); err != nil {
+		return err
+	}
+	lines, err := m.readLines(filename)
+	if err != nil {
+		return err
+	}
+	if start, _ := findBlock(lines, h.Alias); start >= 0 {
+		return fmt.Errorf("host '%s' already exists in %s", h.Alias, filename)
+	}
+
+	// Drop the trailing empty element so the new block is separated by exactly one blank line
+	if n := len(lines); n > 0 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	block := strings.Split(strings.TrimSuffix(h.Format(), "\n"), "\n")
+	lines = append(lines, "")
+	lines = append(lines, block...)
+	lines = append(lines, "")
+
+	return m.writeLines(filename, lines)
+}
+
+// UpdateHost replaces every value of key in the alias block with values.
+// Calling it without values removes the key from the block.
+func (m *Manager) UpdateHost(filename, alias, key string, values ...string) error {
+	if !slices.Contains(Keys, key) {
+		return fmt.Errorf("unknown key '%s'", key)
+	}
+	var scratch HostConfig
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("value for '%s' must be a single line", key)
+		}
+		if err := scratch.Set(key, v); err != nil {
+			return err
+		}
+	}
+
+	lines, err := m.readLines(filename)
+	if err != nil {
+		return err
+	}
+	start, end := findBlock(lines, alias)
+	if start < 0 {
+		return fmt.Errorf("host '%s' not found in %s", alias, filename)
+	}
+
+	indent := "    "
+	for i := start + 1; i < end; i++ {
+		if _, _, ok := splitPair(lines[i]); ok {
+			indent = leadingSpace(lines[i])
+			break
+		}
+	}
+	var added []string
+	for _, v := range values {
+		added = append(added, fmt.Sprintf("%s%s: %s", indent, key, v))
+	}
+
+	// New values take the place of the first existing line for key, or go
+	// right before the closing brace if the key was not set yet
+	out := append([]string{}, lines[:start+1]...)
+	for i := start + 1; i < end; i++ {
+		if k, _, ok := splitPair(lines[i]); ok && k == key {
+			out = append(out, added...)
+			added = nil
+			continue
+		}
+		out = append(out, lines[i])
+	}
+	out = append(out, added...)
+	out = append(out, lines[end:]...)
+
+	return m.writeLines(filename, out)
+}
+
+// DeleteHost removes the alias block from the specified file
+func (m *Manager) DeleteHost(filename, alias string) error {
+	lines, err := m.readLines(filename)
+	if err != nil {
+		return err
+	}
+	start, end := findBlock(lines, alias)
+	if start < 0 {
+		return fmt.Errorf("host '%s' not found in %s", alias, filename)
+	}
+
+	// Take the blank separator line with the block so deletes don't leave gaps behind
+	if start > 0 && strings.TrimSpace(lines[start-1]) == "" {
+		start--
+	}
+	out := append(lines[:start:start], lines[end+1:]...)
+
+	return m.writeLines(filename, out)
+}
+
+// RenameHost changes the alias of a block. Renaming a proxy also updates
+// every server that references it.
+func (m *Manager) RenameHost(filename, oldAlias, newAlias string) error {
+	if err := validateAlias(newAlias); err != nil {
+		return err
+	}
+	lines, err := m.readLines(filename)
+	if err != nil {
+		return err
+	}
+	start, _ := findBlock(lines, oldAlias)
+	if start < 0 {
+		return fmt.Errorf("host '%s' not found in %s", oldAlias, filename)
+	}
+	if other, _ := findBlock(lines, newAlias); other >= 0 {
+		return fmt.Errorf("host '%s' already exists in %s", newAlias, filename)
+	}
+
+	lines[start] = fmt.Sprintf("%s%s {", leadingSpace(lines[start]), newAlias)
+	if err := m.writeLines(filename, lines); err != nil {
+		return err
+	}
+
+	if filename != ProxiesName {
+		return nil
+	}
+
+	// Point servers at the new proxy name
+	cfgLines, err := m.readLines(ConfigName)
+	if err != nil {
+		return err
+	}
+	changed := false
+	inBlock := false
+	for i, l := range cfgLines {
+		trimmed := strings.TrimSpace(l)
+		switch {
+		case strings.HasSuffix(trimmed, "{"):
+			inBlock = true
+		case trimmed == "}":
+			inBlock = false
+		case inBlock:
+			if k, v, ok := splitPair(l); ok && k == "proxy" && v == oldAlias {
+				cfgLines[i] = fmt.Sprintf("%sproxy: %s", leadingSpace(l), newAlias)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return m.writeLines(ConfigName, cfgLines)
+}
+
+// findBlock returns the line indexes of the opening and closing braces of
+// the alias block, or -1, -1 if it does not exist.
+func findBlock(lines []string, alias string) (int, int) {
+	start := -1
+	for i, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasSuffix(trimmed, "{") {
+			if strings.TrimSpace(strings.TrimSuffix(trimmed, "{")) == alias {
+				start = i
+			}
+			continue
+		}
+		if trimmed == "}" && start >= 0 {
+			return start, i
+		}
+	}
+	return -1, -1
+}
+
+// splitPair splits a "key: value" line
+func splitPair(line string) (string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", "", false
+	}
+	parts := strings.SplitN(trimmed, ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+}
+
+func leadingSpace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+func validateAlias(alias string) error {
+	if alias == "" {
+		return fmt.Errorf("alias must not be empty")
+	}
+	if strings.ContainsAny(alias, "{}:# \t\r\n") {
+		return fmt.Errorf("invalid alias '%s': must not contain whitespace or any of '{}:#'", alias)
+	}
+	return nil
+}
+
+func (m *Manager) readLines(filename string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(m.HomeDir, DirName, filename))
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(string(data), "\n"), nil
+}
+
+// writeLines replaces the file contents atomically so a failed write never
+// leaves a half-written config behind.
+func (m *Manager) writeLines(filename string, lines []string) error {
+	return WriteFileAtomic(filepath.Join(m.HomeDir, DirName, filename), []byte(strings.Join(lines, "\n")))
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers see either the old or the new contents.
+func WriteFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
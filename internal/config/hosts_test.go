@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m := &Manager{HomeDir: t.TempDir()}
+	if _, err := m.Initialize(); err != nil {
+		t.Fatalf("Initialize failed: %v", err)
+	}
+	return m
+}
+
+func parseFile(t *testing.T, m *Manager, filename string) []HostConfig {
+	t.Helper()
+	lines, err := m.readLines(filename)
+	if err != nil {
+		t.Fatalf("read %s: %v", filename, err)
+	}
+	configs, err := Parse(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("parse %s: %v", filename, err)
+	}
+	return configs
+}
+
+func TestHostCRUD(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.AddHost(ConfigName, HostConfig{Alias: "web", Host: "10.0.0.1", User: "admin"}); err != nil {
+		t.Fatalf("AddHost failed: %v", err)
+	}
+	if err := m.AddHost(ConfigName, HostConfig{Alias: "web", Host: "10.0.0.2"}); err == nil {
+		t.Errorf("expected duplicate alias error")
+	}
+
+	if err := m.UpdateHost(ConfigName, "web", "port", "2222"); err != nil {
+		t.Fatalf("UpdateHost failed: %v", err)
+	}
+	if err := m.UpdateHost(ConfigName, "web", "user", "deploy"); err != nil {
+		t.Fatalf("UpdateHost failed: %v", err)
+	}
+	if err := m.UpdateHost(ConfigName, "web", "bogus", "x"); err == nil {
+		t.Errorf("expected unknown key error")
+	}
+
+	configs := parseFile(t, m, ConfigName)
+	if len(configs) != 1 || configs[0].User != "deploy" || configs[0].Port != "2222" {
+		t.Fatalf("unexpected configs after update: %+v", configs)
+	}
+
+	if err := m.UpdateHost(ConfigName, "web", "port"); err != nil {
+		t.Fatalf("UpdateHost (remove) failed: %v", err)
+	}
+	if configs := parseFile(t, m, ConfigName); configs[0].Port != "" {
+		t.Errorf("expected port to be removed, got %q", configs[0].Port)
+	}
+
+	if err := m.DeleteHost(ConfigName, "web"); err != nil {
+		t.Fatalf("DeleteHost failed: %v", err)
+	}
+	if configs := parseFile(t, m, ConfigName); len(configs) != 0 {
+		t.Errorf("expected no configs after delete, got %+v", configs)
+	}
+
+	// The documentation header must survive every edit
+	data, _ := os.ReadFile(m.GetConfigPath())
+	if string(data) != ServerConfigHeader {
+		t.Errorf("config was not restored to its header:\n%s", data)
+	}
+}
+
+func TestRenameProxyUpdatesReferences(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.AddHost(ProxiesName, HostConfig{Alias: "p", Host: "proxy.local", Port: "1080", Type: "socks5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddHost(ConfigName, HostConfig{Alias: "a", Host: "1.1.1.1", Proxy: "p"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddHost(ConfigName, HostConfig{Alias: "b", Host: "2.2.2.2", Proxy: "other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.RenameHost(ProxiesName, "p", "corp"); err != nil {
+		t.Fatalf("RenameHost failed: %v", err)
+	}
+
+	proxies := parseFile(t, m, ProxiesName)
+	if len(proxies) != 1 || proxies[0].Alias != "corp" {
+		t.Errorf("proxy not renamed: %+v", proxies)
+	}
+	configs := parseFile(t, m, ConfigName)
+	if configs[0].Proxy != "corp" || configs[1].Proxy != "other" {
+		t.Errorf("proxy references not updated correctly: %+v", configs)
+	}
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Severity ranks lint findings
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityHigh
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityHigh:
+		return "HIGH"
+	case SeverityWarning:
+		return "WARN"
+	default:
+		return "INFO"
+	}
+}
+
+// Finding is a single issue reported by Lint
+type Finding struct {
+	Severity Severity
+	Alias    string // Host the finding is about, empty for file level findings
+	Proxy    bool   // Alias names a proxy, which may share it with a server
+	Path     string
+	Message  string
+}
+
+func (f Finding) String() string {
+	subject := f.Alias
+	switch {
+	case subject == "":
+		subject = f.Path
+	case f.Proxy:
+		subject = "proxy " + subject
+	}
+	return fmt.Sprintf("[%s] %s: %s", f.Severity, subject, f.Message)
+}
+
+// About reports whether f is about the server alias, or the proxy alias
+// when proxy is set
+func (f Finding) About(alias string, proxy bool) bool {
+	return f.Alias != "" && f.Alias == alias && f.Proxy == proxy
+}
+
+// minRSABits is the smallest RSA key size considered adequate
+const minRSABits = 3072
+
+// Lint audits the config directory and the given hosts for insecure
+// settings. Findings are sorted by severity, most severe first.
+func (m *Manager) Lint(servers, proxies []HostConfig) []Finding {
+	var findings []Finding
+
+	if runtime.GOOS != "windows" {
+		findings = append(findings, m.lintPermissions()...)
+	}
+
+	checkedKeys := make(map[string]bool)
+	lintHost := func(h HostConfig, proxy bool) {
+		if h.Password != "" && !strings.HasPrefix(h.Password, SecretPrefix) {
+			findings = append(findings, Finding{SeverityHigh, h.Alias, proxy, "", "plaintext password; move it to the vault with 'mux-ssh secret set' or use password_command"})
+		}
+		if h.User == "root" {
+			findings = append(findings, Finding{SeverityWarning, h.Alias, proxy, "", "logs in as root"})
+		}
+		if h.Type == "http" && (h.User != "" || h.Password != "" || h.PasswordCommand != "") {
+			findings = append(findings, Finding{SeverityHigh, h.Alias, proxy, "", "credentials are sent unencrypted to an http proxy, use type: https"})
+		}
+		if h.IdentityFile != "" {
+			path := m.ExpandPath(h.IdentityFile)
+			if !checkedKeys[path] {
+				checkedKeys[path] = true
+				findings = append(findings, lintIdentity(h.Alias, proxy, path)...)
+			}
+		}
+	}
+	for _, h := range servers {
+		lintHost(h, false)
+	}
+	for _, h := range proxies {
+		lintHost(h, true)
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Severity > findings[j].Severity
+	})
+	return findings
+}
+
+// lintPermissions reports config files and directories other users can access
+func (m *Manager) lintPermissions() []Finding {
+	var findings []Finding
+	dir := filepath.Join(m.HomeDir, DirName)
+
+	check := func(path string, allowed os.FileMode) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		perm := info.Mode().Perm()
+		if perm&^allowed == 0 {
+			return
+		}
+		sev := SeverityWarning
+		if perm&0007 != 0 {
+			sev = SeverityHigh
+		}
+		findings = append(findings, Finding{sev, "", false, path, fmt.Sprintf("permissions %04o are looser than %04o", perm, allowed)})
+	}
+
+	check(dir, 0700)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return findings
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			check(filepath.Join(dir, e.Name()), 0700)
+		} else {
+			check(filepath.Join(dir, e.Name()), 0600)
+		}
+	}
+	return findings
+}
+
+// lintIdentity checks a private key file referenced by alias
+func lintIdentity(alias string, proxy bool, path string) []Finding {
+	info, err := os.Stat(path)
+	if err != nil {
+		return []Finding{{SeverityWarning, alias, proxy, path, "identity file does not exist"}}
+	}
+
+	var findings []Finding
+	if runtime.GOOS != "windows" {
+		perm := info.Mode().Perm()
+		if perm&0004 != 0 {
+			findings = append(findings, Finding{SeverityHigh, alias, proxy, path, fmt.Sprintf("identity file is world-readable (%04o)", perm)})
+		} else if perm&0040 != 0 {
+			findings = append(findings, Finding{SeverityWarning, alias, proxy, path, fmt.Sprintf("identity file is group-readable (%04o)", perm)})
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return findings
+	}
+
+	var pub ssh.PublicKey
+	key, err := ssh.ParseRawPrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	switch {
+	case err == nil:
+		findings = append(findings, Finding{SeverityWarning, alias, proxy, path, "identity file is not protected by a passphrase"})
+		if k, ok := key.(*rsa.PrivateKey); ok && k.N.BitLen() < minRSABits {
+			findings = append(findings, Finding{SeverityWarning, alias, proxy, path, fmt.Sprintf("RSA key is %d bits, use at least %d or switch to ed25519", k.N.BitLen(), minRSABits)})
+		}
+		return findings
+	case errors.As(err, &missing):
+		pub = missing.PublicKey
+	}
+
+	// Encrypted keys only reveal their size through the public half
+	if pub == nil {
+		if pubData, err := os.ReadFile(path + ".pub"); err == nil {
+			pub, _, _, _, _ = ssh.ParseAuthorizedKey(pubData)
+		}
+	}
+	if pub != nil && pub.Type() == ssh.KeyAlgoRSA {
+		if cpk, ok := pub.(ssh.CryptoPublicKey); ok {
+			if k, ok := cpk.CryptoPublicKey().(*rsa.PublicKey); ok && k.N.BitLen() < minRSABits {
+				findings = append(findings, Finding{SeverityWarning, alias, proxy, path, fmt.Sprintf("RSA key is %d bits, use at least %d or switch to ed25519", k.N.BitLen(), minRSABits)})
+			}
+		}
+	}
+	return findings
+}
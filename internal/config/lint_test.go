@@ -0,0 +1,76 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLint(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission checks are unix only")
+	}
+	m := newTestManager(t)
+	os.Chmod(m.GetProxiesPath(), 0644)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(rsaKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(m.HomeDir, "id_rsa")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	servers := []HostConfig{
+		{Alias: "db", Host: "10.0.0.1", User: "root", IdentityFile: "~/id_rsa"},
+		{Alias: "web", Host: "10.0.0.2", IdentityFile: "~/missing"},
+		{Alias: "gw", Host: "10.0.0.3"},
+	}
+	proxies := []HostConfig{
+		{Alias: "gw", Host: "proxy", Type: "http", User: "bob", Password: "hunter2"},
+		{Alias: "vpn", Host: "vpn", Type: "socks5", User: "bob", Password: "secret:vpn"},
+	}
+
+	var got []string
+	for _, f := range m.Lint(servers, proxies) {
+		got = append(got, f.String())
+		if f.About("gw", false) {
+			t.Errorf("the proxy's finding is attributed to the server of the same name: %s", f)
+		}
+	}
+	all := strings.Join(got, "\n")
+
+	want := []string{
+		"[HIGH] " + m.GetProxiesPath() + ": permissions 0644",
+		"[HIGH] proxy gw: plaintext password",
+		"[HIGH] proxy gw: credentials are sent unencrypted",
+		"[HIGH] db: identity file is world-readable",
+		"[WARN] db: logs in as root",
+		"[WARN] db: identity file is not protected",
+		"[WARN] db: RSA key is 2048 bits",
+		"[WARN] web: identity file does not exist",
+	}
+	for _, w := range want {
+		if !strings.Contains(all, w) {
+			t.Errorf("missing finding %q in:\n%s", w, all)
+		}
+	}
+	if strings.Contains(all, "vpn") {
+		t.Errorf("vault-backed proxy should be clean:\n%s", all)
+	}
+	if !strings.HasPrefix(got[0], "[HIGH]") || !strings.HasPrefix(got[len(got)-1], "[WARN]") {
+		t.Errorf("findings are not sorted by severity:\n%s", all)
+	}
+}
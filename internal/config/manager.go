@@ -17,6 +17,12 @@ const (
 // Manager handles configuration file operations
 type Manager struct {
 	HomeDir string
+
+	// Passphrase asks for the vault passphrase. create is true when the
+	// vault does not exist yet and the passphrase should be confirmed.
+	Passphrase func(create bool) (string, error)
+
+	vault *Vault
 }
 
 // NewManager creates a new configuration manager
@@ -38,6 +44,32 @@ func (m *Manager) GetProxiesPath() string {
 	return filepath.Join(m.HomeDir, DirName, ProxiesName)
 }
 
+// Load parses one of the config files
+func (m *Manager) Load(filename string) ([]HostConfig, error) {
+	f, err := os.Open(filepath.Join(m.HomeDir, DirName, filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	configs, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return configs, nil
+}
+
+// ExpandPath replaces a leading ~ with the user's home directory
+func (m *Manager) ExpandPath(path string) string {
+	if path == "~" {
+		return m.HomeDir
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(m.HomeDir, rest)
+	}
+	return path
+}
+
 // Headers for documentation
 const ServerConfigHeader = `# SSH OGM Server Configuration
 # Syntax: Alias { host: ... user: ... }
@@ -46,21 +78,32 @@ const ServerConfigHeader = `# SSH OGM Server Configuration
 #    host: 1.2.3.4
 #    user: root
 #    port: 22
+#    hostkey: SHA256:... # Optional, repeatable, pin keys with 'mux-ssh pin <alias>'
+#    auth_check: yes # Optional, health checks log in to catch revoked keys
+#    check: http https://app.example.com/healthz # Optional, repeatable: ssh, tcp [port], icmp, http <url> [status], command <cmd>
+#    check_mode: any # Optional, all (default) or any of the checks must pass
 #    proxy: myproxy # Optional
+#    command: tmux new -A -s main # Optional, run on connect
+#    cwd: /srv/app # Optional
+#    client: native # Optional, built-in client instead of the ssh binary
+#    owner: team-web # Optional, also description: and link:
+#    tags: prod, web # Optional
 # }
 
 `
 
 const ProxyConfigHeader = `# SSH OGM Proxy Configuration
 # Syntax: Alias { host: ... port: ... type: ... }
-# Types: socks5, http
+# Types: socks5, http, https
 # Example:
 # myproxy {
 #    host: proxy.example.com
 #    port: 1080
 #    type: socks5
 #    user: user # Optional
-#    password: pass # Optional
+#    password: secret:myproxy # Optional, stored with 'mux-ssh secret set myproxy'
+#    password_command: pass show myproxy # Optional, alternative to password
+#    ca_bundle: ~/certs/corp-ca.pem # Optional, for https proxies with a private CA
 # }
 
 `
@@ -87,6 +130,11 @@ func (m *Manager) Initialize() (bool, error) {
 		return false, err
 	}
 
+	_, err = m.ensureFile(SourcesName, SourcesConfigHeader)
+	if err != nil {
+		return false, err
+	}
+
 	return firstRun, nil
 }
 
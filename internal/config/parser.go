@@ -2,7 +2,11 @@ package config
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"regexp"
+	"slices"
 	"strings"
 	"io"
 )
@@ -13,19 +17,96 @@ type HostConfig struct {
 	User         string
 	Port         string
 	IdentityFile string
+	HostKeys     []string // Pinned SHA256 fingerprints, replacing known_hosts for this host
+	AuthCheck    bool     // Health checks log in as User instead of stopping at the auth prompt
+	authCheckSet bool     // auth_check was given, so an explicit no overrides lower layers
+	Checks       []string // Health checks to run, see ParseCheck; the SSH check if empty
+	CheckMode    string   // How the checks combine: all (default) or any
 	
 	// Proxy specific
 	Proxy    string // Name of the proxy to use (for Servers)
 	Password string // (for Proxies)
-	Type     string // socks5, http (for Proxies)
+	Type     string // socks5, http, https (for Proxies)
+	CABundle string // PEM file trusted for https proxies instead of the system roots
+
+	// Run on connect instead of a plain login shell
+	Command string
+	Cwd     string
+
+	// Environment for the remote session
+	Env     []string // KEY=VALUE, sent with SetEnv
+	SendEnv []string // local variable names or patterns, sent with SendEnv
+
+	// Which SSH client connects: openssh (the ssh binary) or native (built in)
+	Client string
+
+	// Metadata shown in the dashboard
+	Tags        []string // e.g. Ansible groups
+	Description string
+	Owner       string
+	Link        string // runbook or wiki URL
+
+	// External secret managers, run lazily by the ssh package
+	PasswordCommand string // prints the password on stdout
+	IdentityCommand string // prints a private key on stdout
 }
 
 // Parse reads the configuration from the reader and returns a list of HostConfigs
 func Parse(r io.Reader) ([]HostConfig, error) {
-	scanner := bufio.NewScanner(r)
+	configs, _, err := parseAllowed(r, nil)
+	return configs, err
+}
+
+// RemoteKeys are the keys accepted from remote sources. They only describe
+// hosts; keys that make mux-ssh run commands or log in on its own are left
+// to local files.
+var RemoteKeys = []string{"description", "owner", "link", "tags", "host", "user", "port", "hostkey", "proxy"}
+
+// parseAllowed is Parse restricted to the keys in allowed, or any key when
+// allowed is nil. Other keys are skipped and returned as "alias: key".
+func parseAllowed(r io.Reader, allowed []string) ([]HostConfig, []string, error) {
+	blocks, err := parseBlocks(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var configs []HostConfig
-	var currentConfig *HostConfig
-	
+	var skipped []string
+	for _, b := range blocks {
+		currentConfig := HostConfig{Alias: b.Alias}
+		for _, p := range b.Pairs {
+			if allowed != nil && !slices.Contains(allowed, p.Key) {
+				skipped = append(skipped, b.Alias+": "+p.Key)
+				continue
+			}
+			if err := currentConfig.Set(p.Key, p.Value); err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", p.Line, err)
+			}
+		}
+		configs = append(configs, currentConfig)
+	}
+	return configs, skipped, nil
+}
+
+// block is one "Alias { key: value ... }" section of a config file
+type block struct {
+	Alias string
+	Pairs []pair
+}
+
+type pair struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// parseBlocks reads the block syntax shared by all config files without
+// interpreting the keys.
+func parseBlocks(r io.Reader) ([]block, error) {
+	scanner := bufio.NewScanner(r)
+	var blocks []block
+	var current *block
+
 	lineNum := 0
 	inBlock := false
 
@@ -47,7 +128,7 @@ func Parse(r io.Reader) ([]HostConfig, error) {
 			if alias == "" {
 				return nil, fmt.Errorf("line %d: missing alias before '{'", lineNum)
 			}
-			currentConfig = &HostConfig{Alias: alias}
+			current = &block{Alias: alias}
 			inBlock = true
 			continue
 		}
@@ -57,9 +138,9 @@ func Parse(r io.Reader) ([]HostConfig, error) {
 			if !inBlock {
 				return nil, fmt.Errorf("line %d: unexpected closing brace", lineNum)
 			}
-			if currentConfig != nil {
-				configs = append(configs, *currentConfig)
-				currentConfig = nil
+			if current != nil {
+				blocks = append(blocks, *current)
+				current = nil
 			}
 			inBlock = false
 			continue
@@ -71,29 +152,11 @@ func Parse(r io.Reader) ([]HostConfig, error) {
 			if len(parts) != 2 {
 				return nil, fmt.Errorf("line %d: expected 'key: value'", lineNum)
 			}
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-
-			switch key {
-			case "host":
-				currentConfig.Host = value
-			case "user":
-				currentConfig.User = value
-			case "port":
-				currentConfig.Port = value
-			case "identity":
-				currentConfig.IdentityFile = value
-			case "proxy":
-				currentConfig.Proxy = value
-			case "password":
-				currentConfig.Password = value
-			case "type":
-				currentConfig.Type = value
-			default:
-				// Decide if we error on unknown keys or ignore. Sticking to simple options for now.
-				// For extensibility, we might ignore or warn. Let's error to be strict as requested.
-				return nil, fmt.Errorf("line %d: unknown key '%s'", lineNum, key)
-			}
+			current.Pairs = append(current.Pairs, pair{
+				Key:   strings.TrimSpace(parts[0]),
+				Value: strings.TrimSpace(parts[1]),
+				Line:  lineNum,
+			})
 			continue
 		}
 
@@ -109,5 +172,203 @@ func Parse(r io.Reader) ([]HostConfig, error) {
 		return nil, err
 	}
 
-	return configs, nil
+	return blocks, nil
+}
+
+var (
+	envNameRe    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envPatternRe = regexp.MustCompile(`^[A-Za-z0-9_*?]+$`)
+)
+
+// Values of the client key
+const (
+	ClientOpenSSH = "openssh"
+	ClientNative  = "native"
+)
+
+// Keys lists the supported block keys in the order they are written out.
+var Keys = []string{"description", "owner", "link", "tags", "host", "user", "port", "hostkey", "auth_check", "check", "check_mode", "identity", "identity_command", "proxy", "command", "cwd", "env", "send_env", "client", "type", "ca_bundle", "password", "password_command"}
+
+// Set assigns value to the field named by key
+func (cfg *HostConfig) Set(key, value string) error {
+	switch key {
+	case "host":
+		cfg.Host = value
+	case "user":
+		cfg.User = value
+	case "port":
+		cfg.Port = value
+	case "hostkey":
+		// Repeatable, so a new key can be pinned before the old one is retired
+		if !validFingerprint(value) {
+			return fmt.Errorf("invalid hostkey '%s': expected a SHA256:... fingerprint", value)
+		}
+		if !slices.Contains(cfg.HostKeys, value) {
+			cfg.HostKeys = append(cfg.HostKeys, value)
+		}
+	case "auth_check":
+		switch value {
+		case "yes":
+			cfg.AuthCheck = true
+		case "no":
+			cfg.AuthCheck = false
+		default:
+			return fmt.Errorf("invalid auth_check '%s': expected yes or no", value)
+		}
+		cfg.authCheckSet = true
+	case "check":
+		// Repeatable, several checks combine according to check_mode
+		spec, err := ParseCheck(value)
+		if err != nil {
+			return err
+		}
+		if value = spec.String(); !slices.Contains(cfg.Checks, value) {
+			cfg.Checks = append(cfg.Checks, value)
+		}
+	case "check_mode":
+		if value != CheckModeAll && value != CheckModeAny {
+			return fmt.Errorf("invalid check_mode '%s': expected %s or %s", value, CheckModeAll, CheckModeAny)
+		}
+		cfg.CheckMode = value
+	case "identity":
+		cfg.IdentityFile = value
+	case "proxy":
+		cfg.Proxy = value
+	case "password":
+		cfg.Password = value
+	case "type":
+		cfg.Type = value
+	case "ca_bundle":
+		cfg.CABundle = value
+	case "command":
+		cfg.Command = value
+	case "cwd":
+		cfg.Cwd = value
+	case "env":
+		name, _, ok := strings.Cut(value, "=")
+		if !ok || !envNameRe.MatchString(name) {
+			return fmt.Errorf("invalid env '%s': expected NAME=VALUE", value)
+		}
+		cfg.Env = append(cfg.Env, value)
+	case "send_env":
+		if !envPatternRe.MatchString(value) {
+			return fmt.Errorf("invalid send_env pattern '%s'", value)
+		}
+		cfg.SendEnv = append(cfg.SendEnv, value)
+	case "client":
+		if value != ClientOpenSSH && value != ClientNative {
+			return fmt.Errorf("invalid client '%s': expected %s or %s", value, ClientOpenSSH, ClientNative)
+		}
+		cfg.Client = value
+	case "tags":
+		// Comma separated, may also be repeated
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(cfg.Tags, tag) {
+				cfg.Tags = append(cfg.Tags, tag)
+			}
+		}
+	case "description":
+		cfg.Description = value
+	case "owner":
+		cfg.Owner = value
+	case "link":
+		cfg.Link = value
+	case "password_command":
+		cfg.PasswordCommand = value
+	case "identity_command":
+		cfg.IdentityCommand = value
+	default:
+		// Decide if we error on unknown keys or ignore. Sticking to simple options for now.
+		// For extensibility, we might ignore or warn. Let's error to be strict as requested.
+		return fmt.Errorf("unknown key '%s'", key)
+	}
+	return nil
+}
+
+// validFingerprint reports whether s looks like the SHA256 fingerprints
+// printed by ssh-keygen -l
+func validFingerprint(s string) bool {
+	b64, ok := strings.CutPrefix(s, "SHA256:")
+	if !ok {
+		return false
+	}
+	sum, err := base64.RawStdEncoding.DecodeString(b64)
+	return err == nil && len(sum) == sha256.Size
+}
+
+// Values returns the values stored under key, or nil if the key is unset.
+func (h HostConfig) Values(key string) []string {
+	var v string
+	switch key {
+	case "env":
+		return h.Env
+	case "send_env":
+		return h.SendEnv
+	case "hostkey":
+		return h.HostKeys
+	case "auth_check":
+		if h.AuthCheck {
+			v = "yes"
+		} else if h.authCheckSet {
+			v = "no"
+		}
+	case "check":
+		return h.Checks
+	case "check_mode":
+		v = h.CheckMode
+	case "tags":
+		if len(h.Tags) == 0 {
+			return nil
+		}
+		return []string{strings.Join(h.Tags, ", ")}
+	case "host":
+		v = h.Host
+	case "user":
+		v = h.User
+	case "port":
+		v = h.Port
+	case "identity":
+		v = h.IdentityFile
+	case "proxy":
+		v = h.Proxy
+	case "password":
+		v = h.Password
+	case "type":
+		v = h.Type
+	case "ca_bundle":
+		v = h.CABundle
+	case "command":
+		v = h.Command
+	case "cwd":
+		v = h.Cwd
+	case "client":
+		v = h.Client
+	case "description":
+		v = h.Description
+	case "owner":
+		v = h.Owner
+	case "link":
+		v = h.Link
+	case "password_command":
+		v = h.PasswordCommand
+	case "identity_command":
+		v = h.IdentityCommand
+	}
+	if v == "" {
+		return nil
+	}
+	return []string{v}
+}
+
+// Format renders h as a configuration block.
+func (h HostConfig) Format() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s {\n", h.Alias)
+	for _, key := range Keys {
+		for _, v := range h.Values(key) {
+			fmt.Fprintf(&b, "    %s: %s\n", key, v)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
 }
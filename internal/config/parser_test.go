@@ -52,6 +52,14 @@ func TestParseErrors(t *testing.T) {
 		{"Bad pair", "a { host }"},
 		{"Unknown key", "a { foo: bar }"},
 		{"Unclosed block", "a { host: x"},
+		{"Bad env name", "a {\nenv: 1BAD=x\n}"},
+		{"Env without value", "a {\nenv: FOO\n}"},
+		{"Bad send_env pattern", "a {\nsend_env: LC-*\n}"},
+		{"MD5 hostkey", "a {\nhostkey: MD5:16:27:ac:a5:76:28:2d:36:63:1b:56:4d:eb:df:a6:48\n}"},
+		{"Truncated hostkey", "a {\nhostkey: SHA256:abc\n}"},
+		{"Bad auth_check", "a {\nauth_check: true\n}"},
+		{"Unknown check", "a {\ncheck: smtp\n}"},
+		{"Bad check_mode", "a {\ncheck_mode: majority\n}"},
 	}
 
 	for _, tt := range tests {
@@ -64,3 +72,32 @@ func TestParseErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestParseEnv(t *testing.T) {
+	input := `
+app {
+    host: app.example.com
+    env: DEPLOY_ENV=prod
+    env: GREETING=hello world
+    send_env: LC_*
+}
+`
+	configs, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	c := configs[0]
+	if len(c.Env) != 2 || c.Env[0] != "DEPLOY_ENV=prod" || c.Env[1] != "GREETING=hello world" {
+		t.Errorf("env parsed incorrectly: %q", c.Env)
+	}
+	if len(c.SendEnv) != 1 || c.SendEnv[0] != "LC_*" {
+		t.Errorf("send_env parsed incorrectly: %q", c.SendEnv)
+	}
+
+	// Repeatable keys survive a format/parse round trip
+	again, err := Parse(strings.NewReader(c.Format()))
+	if err != nil || len(again[0].Env) != 2 {
+		t.Errorf("round trip failed: %v %+v", err, again)
+	}
+}
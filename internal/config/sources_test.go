@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLayeredInventory(t *testing.T) {
+	m := newTestManager(t)
+
+	oldSystem := SystemDir
+	SystemDir = t.TempDir()
+	defer func() { SystemDir = oldSystem }()
+
+	teamDir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(filepath.Join(SystemDir, ConfigName), "web {\n host: 10.0.0.1\n user: ubuntu\n port: 22\n auth_check: yes\n}\n")
+	write(filepath.Join(teamDir, ConfigName), "web {\n port: 2222\n env: A=1\n}\ndb {\n host: 10.0.0.2\n}\n")
+	write(filepath.Join(teamDir, ProxiesName), "corp {\n host: proxy\n port: 1080\n}\n")
+	write(m.GetSourcesPath(), "team {\n dir: "+teamDir+"\n}\nghost {\n dir: /does/not/exist\n}\n")
+	personal := HostConfig{Alias: "web", User: "alice"}
+	personal.Set("auth_check", "no")
+	if err := m.AddHost(ConfigName, personal); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := m.LoadInventory()
+	if err != nil {
+		t.Fatalf("LoadInventory failed: %v", err)
+	}
+
+	if len(inv.Servers) != 2 || inv.Servers[0].Alias != "web" || inv.Servers[1].Alias != "db" {
+		t.Fatalf("unexpected servers: %+v", inv.Servers)
+	}
+	web := inv.Servers[0]
+	if web.Host != "10.0.0.1" || web.User != "alice" || web.Port != "2222" || len(web.Env) != 1 || web.AuthCheck {
+		t.Errorf("web merged incorrectly: %+v", web)
+	}
+	if len(inv.Proxies) != 1 || inv.Proxies[0].Alias != "corp" {
+		t.Errorf("unexpected proxies: %+v", inv.Proxies)
+	}
+	if len(inv.Warnings) != 1 {
+		t.Errorf("expected a warning for the missing source, got %q", inv.Warnings)
+	}
+
+	fields, isProxy, err := inv.Explain("web")
+	if err != nil || isProxy {
+		t.Fatalf("Explain failed: %v (proxy=%v)", err, isProxy)
+	}
+	want := map[string]string{"host": "system", "user": "personal", "port": "team", "env": "team", "auth_check": "personal"}
+	for _, f := range fields {
+		if want[f.Key] != f.Layer {
+			t.Errorf("%s: expected layer %q, got %q", f.Key, want[f.Key], f.Layer)
+		}
+		delete(want, f.Key)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing fields in explanation: %v", want)
+	}
+}
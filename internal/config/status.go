@@ -0,0 +1,64 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const StatusName = "status.json"
+
+// HostStatus is the result of the last health check of a host
+type HostStatus struct {
+	Status  string // online, offline, ...
+	Checked time.Time
+}
+
+// StatusCache remembers health results between runs, keyed by alias
+type StatusCache struct {
+	Servers map[string]HostStatus
+	Proxies map[string]HostStatus
+}
+
+// GetStatusPath returns the file the dashboard stores health results in
+func (m *Manager) GetStatusPath() string {
+	return filepath.Join(m.GetCacheDir(), StatusName)
+}
+
+// LoadStatuses returns the last known health of every host. A missing or
+// unreadable file just means nothing has been checked yet.
+func (m *Manager) LoadStatuses() StatusCache {
+	c := StatusCache{}
+	if data, err := os.ReadFile(m.GetStatusPath()); err == nil {
+		json.Unmarshal(data, &c)
+	}
+	if c.Servers == nil {
+		c.Servers = make(map[string]HostStatus)
+	}
+	if c.Proxies == nil {
+		c.Proxies = make(map[string]HostStatus)
+	}
+	return c
+}
+
+// SaveStatuses merges the given results into the status file, keeping
+// older results for hosts that were not checked this time.
+func (m *Manager) SaveStatuses(servers, proxies map[string]HostStatus) error {
+	c := m.LoadStatuses()
+	for alias, s := range servers {
+		c.Servers[alias] = s
+	}
+	for alias, s := range proxies {
+		c.Proxies[alias] = s
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.GetCacheDir(), 0700); err != nil {
+		return err
+	}
+	return WriteFileAtomic(m.GetStatusPath(), data)
+}
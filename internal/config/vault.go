@@ -0,0 +1,192 @@
+package config
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	SecretsName  = "secrets.enc"
+	SecretPrefix = "secret:"
+)
+
+// vaultMagic identifies the file format and is authenticated along with the payload
+var vaultMagic = []byte("MUXVAULT1")
+
+const vaultSaltSize = 16
+
+// ErrWrongPassphrase is returned when the vault cannot be decrypted
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted vault")
+
+// Vault is an encrypted name -> secret store kept next to the config files.
+// The key is derived from a passphrase with Argon2id and the contents are
+// sealed with XChaCha20-Poly1305.
+type Vault struct {
+	path    string
+	key     []byte
+	salt    []byte
+	secrets map[string]string
+}
+
+// OpenVault decrypts the vault at path. A missing file yields an empty vault
+// that will be created on the first Save.
+func OpenVault(path, passphrase string) (*Vault, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		salt := make([]byte, vaultSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		return &Vault{
+			path:    path,
+			key:     deriveVaultKey(passphrase, salt),
+			salt:    salt,
+			secrets: make(map[string]string),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	header := len(vaultMagic) + vaultSaltSize + chacha20poly1305.NonceSizeX
+	if len(data) < header || !bytes.HasPrefix(data, vaultMagic) {
+		return nil, fmt.Errorf("%s is not a mux-ssh vault", path)
+	}
+	salt := data[len(vaultMagic) : len(vaultMagic)+vaultSaltSize]
+	nonce := data[len(vaultMagic)+vaultSaltSize : header]
+
+	key := deriveVaultKey(passphrase, salt)
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, data[header:], vaultMagic)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to decode vault: %w", err)
+	}
+	return &Vault{path: path, key: key, salt: salt, secrets: secrets}, nil
+}
+
+func deriveVaultKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 3, 64*1024, 4, chacha20poly1305.KeySize)
+}
+
+// Get returns the secret stored under name
+func (v *Vault) Get(name string) (string, bool) {
+	s, ok := v.secrets[name]
+	return s, ok
+}
+
+// Set stores value under name. Call Save to persist it.
+func (v *Vault) Set(name, value string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return fmt.Errorf("invalid secret name '%s'", name)
+	}
+	v.secrets[name] = value
+	return nil
+}
+
+// Delete removes name from the vault. Call Save to persist it.
+func (v *Vault) Delete(name string) error {
+	if _, ok := v.secrets[name]; !ok {
+		return fmt.Errorf("secret '%s' not found", name)
+	}
+	delete(v.secrets, name)
+	return nil
+}
+
+// Names returns the sorted secret names
+func (v *Vault) Names() []string {
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save encrypts the vault with a fresh nonce and writes it atomically
+func (v *Vault) Save() error {
+	plain, err := json.Marshal(v.secrets)
+	if err != nil {
+		return err
+	}
+	aead, err := chacha20poly1305.NewX(v.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	out := append([]byte{}, vaultMagic...)
+	out = append(out, v.salt...)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, plain, vaultMagic)
+
+	return WriteFileAtomic(v.path, out)
+}
+
+// GetSecretsPath returns the absolute path to the encrypted secrets file
+func (m *Manager) GetSecretsPath() string {
+	return filepath.Join(m.HomeDir, DirName, SecretsName)
+}
+
+// Vault unlocks the secrets vault, asking for the passphrase through
+// m.Passphrase the first time. The unlocked vault is kept for the rest of the session.
+func (m *Manager) Vault() (*Vault, error) {
+	if m.vault != nil {
+		return m.vault, nil
+	}
+	if m.Passphrase == nil {
+		return nil, fmt.Errorf("vault is locked and no passphrase prompt is available")
+	}
+
+	_, err := os.Stat(m.GetSecretsPath())
+	create := os.IsNotExist(err)
+	passphrase, err := m.Passphrase(create)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := OpenVault(m.GetSecretsPath(), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	m.vault = v
+	return v, nil
+}
+
+// ResolveSecret returns value itself, or the vault entry it names if it
+// has the "secret:" prefix.
+func (m *Manager) ResolveSecret(value string) (string, error) {
+	name, ok := strings.CutPrefix(value, SecretPrefix)
+	if !ok {
+		return value, nil
+	}
+	v, err := m.Vault()
+	if err != nil {
+		return "", err
+	}
+	secret, ok := v.Get(name)
+	if !ok {
+		return "", fmt.Errorf("secret '%s' not found in vault", name)
+	}
+	return secret, nil
+}
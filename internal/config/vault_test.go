@@ -0,0 +1,62 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SecretsName)
+
+	v, err := OpenVault(path, "correct horse")
+	if err != nil {
+		t.Fatalf("OpenVault failed: %v", err)
+	}
+	if err := v.Set("corp-proxy", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if _, err := OpenVault(path, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("expected ErrWrongPassphrase, got %v", err)
+	}
+
+	v, err = OpenVault(path, "correct horse")
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if got, ok := v.Get("corp-proxy"); !ok || got != "hunter2" {
+		t.Errorf("expected hunter2, got %q (found=%v)", got, ok)
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	m := newTestManager(t)
+	prompts := 0
+	m.Passphrase = func(bool) (string, error) {
+		prompts++
+		return "pw", nil
+	}
+
+	v, err := m.Vault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("db", "s3cret")
+
+	if got, err := m.ResolveSecret("plain"); err != nil || got != "plain" {
+		t.Errorf("plain value changed: %q, %v", got, err)
+	}
+	if got, err := m.ResolveSecret("secret:db"); err != nil || got != "s3cret" {
+		t.Errorf("expected s3cret, got %q, %v", got, err)
+	}
+	if _, err := m.ResolveSecret("secret:missing"); err == nil {
+		t.Errorf("expected error for missing secret")
+	}
+	if prompts != 1 {
+		t.Errorf("expected passphrase to be asked once, got %d", prompts)
+	}
+}
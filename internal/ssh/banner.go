@@ -0,0 +1,182 @@
+package ssh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Negotiated lists the algorithms agreed on during key exchange, for the
+// client to server direction
+type Negotiated struct {
+	KeyExchange string
+	HostKey     string
+	Cipher      string
+	MAC         string // Empty for AEAD ciphers, which authenticate by themselves
+}
+
+// maxKexRecord bounds how much of each direction kexRecorder keeps. Version
+// lines and KEXINIT packets are a few kilobytes at most.
+const maxKexRecord = 64 * 1024
+
+// kexRecorder keeps the start of both directions of a connection so the
+// KEXINIT packets can be read back once the handshake is over. The SSH
+// library does not expose what it negotiated before authentication succeeds.
+// The SSH transport reads from its own goroutine, so the buffers are locked.
+type kexRecorder struct {
+	net.Conn
+	mu            sync.Mutex
+	read, written []byte
+}
+
+func (c *kexRecorder) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.mu.Lock()
+	if len(c.read) < maxKexRecord {
+		c.read = append(c.read, p[:n]...)
+	}
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *kexRecorder) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	if len(c.written) < maxKexRecord {
+		c.written = append(c.written, p...)
+	}
+	c.mu.Unlock()
+	return c.Conn.Write(p)
+}
+
+// negotiated works out the algorithms both sides agreed on the way RFC 4253
+// describes: the first of the client's algorithms the server also supports.
+func (c *kexRecorder) negotiated() (*Negotiated, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	client, err := parseKexInit(c.written)
+	if err != nil {
+		return nil, err
+	}
+	server, err := parseKexInit(c.read)
+	if err != nil {
+		return nil, err
+	}
+	agree := func(i int) string {
+		for _, algo := range client[i] {
+			if slices.Contains(server[i], algo) {
+				return algo
+			}
+		}
+		return ""
+	}
+	n := &Negotiated{KeyExchange: agree(0), HostKey: agree(1), Cipher: agree(2), MAC: agree(4)}
+	if strings.Contains(n.Cipher, "gcm") || strings.Contains(n.Cipher, "poly1305") {
+		n.MAC = ""
+	}
+	return n, nil
+}
+
+// parseKexInit returns the name-lists of the KEXINIT packet that follows
+// the version line in stream: kex, host key, ciphers, MACs and compression
+// for each direction.
+func parseKexInit(stream []byte) ([][]string, error) {
+	// Servers may send other lines before their version
+	for !bytes.HasPrefix(stream, []byte("SSH-")) {
+		i := bytes.IndexByte(stream, '\n')
+		if i < 0 {
+			return nil, errors.New("no version line")
+		}
+		stream = stream[i+1:]
+	}
+	i := bytes.IndexByte(stream, '\n')
+	if i < 0 {
+		return nil, errors.New("no version line")
+	}
+	packet := stream[i+1:]
+
+	if len(packet) < 5 {
+		return nil, errors.New("short packet")
+	}
+	length := binary.BigEndian.Uint32(packet)
+	padding := uint32(packet[4])
+	if length < padding+1 || uint32(len(packet)) < 4+length {
+		return nil, errors.New("truncated packet")
+	}
+	payload := packet[5 : 4+length-padding]
+	const msgKexInit = 20
+	if len(payload) < 17 || payload[0] != msgKexInit {
+		return nil, errors.New("not a KEXINIT packet")
+	}
+
+	rest := payload[17:] // Message type and cookie
+	var lists [][]string
+	for range 8 {
+		if len(rest) < 4 {
+			return nil, errors.New("truncated name-list")
+		}
+		n := binary.BigEndian.Uint32(rest)
+		if uint32(len(rest)) < 4+n {
+			return nil, errors.New("truncated name-list")
+		}
+		var names []string
+		if n > 0 {
+			names = strings.Split(string(rest[4:4+n]), ",")
+		}
+		lists = append(lists, names)
+		rest = rest[4+n:]
+	}
+	return lists, nil
+}
+
+// ParseBanner splits an identification string like
+// "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13" into the product ("OpenSSH"),
+// its version ("9.6p1") and the comment after the space.
+func ParseBanner(banner string) (product, version, comment string) {
+	banner = strings.TrimRight(banner, "\r\n")
+	software := banner
+	if parts := strings.SplitN(banner, "-", 3); len(parts) == 3 {
+		software = parts[2]
+	}
+	software, comment, _ = strings.Cut(software, " ")
+	product, version, _ = strings.Cut(software, "_")
+	return product, version, comment
+}
+
+// CompareVersions compares versions like "8.9p1" and "9.0" by their numbers,
+// so 8.9p1 < 9.0 < 9.0p1.
+func CompareVersions(a, b string) int {
+	na, nb := versionNumbers(a), versionNumbers(b)
+	for i := range min(len(na), len(nb)) {
+		if na[i] != nb[i] {
+			if na[i] < nb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(na) < len(nb):
+		return -1
+	case len(na) > len(nb):
+		return 1
+	}
+	return 0
+}
+
+func versionNumbers(v string) []int {
+	var nums []int
+	for _, field := range strings.FieldsFunc(v, func(r rune) bool { return !unicode.IsDigit(r) }) {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			break
+		}
+		nums = append(nums, n)
+	}
+	return nums
+}
@@ -0,0 +1,38 @@
+package ssh
+
+import "testing"
+
+func TestParseBanner(t *testing.T) {
+	tests := []struct {
+		banner, product, version, comment string
+	}{
+		{"SSH-2.0-OpenSSH_8.2p1 Ubuntu-4ubuntu0.5\r\n", "OpenSSH", "8.2p1", "Ubuntu-4ubuntu0.5"},
+		{"SSH-2.0-OpenSSH_9.6", "OpenSSH", "9.6", ""},
+		{"SSH-2.0-dropbear_2022.83", "dropbear", "2022.83", ""},
+		{"SSH-2.0-Go", "Go", "", ""},
+	}
+	for _, tt := range tests {
+		product, version, comment := ParseBanner(tt.banner)
+		if product != tt.product || version != tt.version || comment != tt.comment {
+			t.Errorf("ParseBanner(%q) = %q, %q, %q", tt.banner, product, version, comment)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"8.9p1", "9.0", -1},
+		{"9.0", "9.0p1", -1},
+		{"9.0p1", "9.0", 1},
+		{"10.0p2", "9.9p1", 1},
+		{"7.4", "7.4", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"ssh-ogm/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checker is one way of telling whether a server is up. Which ones run for
+// a host is chosen with its check key.
+type Checker interface {
+	// Name identifies the check in results, e.g. "tcp 8443"
+	Name() string
+	// Check checks c, through proxy when c has one. proxy is nil when
+	// c.Proxy is not in proxies.conf.
+	Check(c config.HostConfig, proxy *config.HostConfig) ServerHealth
+}
+
+// CheckResult is the outcome of one of the checks of a server
+type CheckResult struct {
+	Name   string
+	Status ServerStatus
+	Error  error
+}
+
+// NewChecker returns the checker for a parsed check value
+func NewChecker(spec config.CheckSpec) Checker {
+	n := named{spec}
+	switch spec.Kind {
+	case config.CheckTCP:
+		return tcpCheck{n}
+	case config.CheckICMP:
+		return icmpCheck{n}
+	case config.CheckHTTP:
+		return httpCheck{n}
+	case config.CheckCommand:
+		return commandCheck{n}
+	}
+	return sshCheck{n}
+}
+
+// Checkers returns the checks configured for c, or the SSH check when it
+// has none
+func Checkers(c config.HostConfig) []Checker {
+	var checkers []Checker
+	for _, value := range c.Checks {
+		// Already validated by the parser
+		if spec, err := config.ParseCheck(value); err == nil {
+			checkers = append(checkers, NewChecker(spec))
+		}
+	}
+	if len(checkers) == 0 {
+		return []Checker{NewChecker(config.CheckSpec{Kind: config.CheckSSH})}
+	}
+	return checkers
+}
+
+// CheckHost runs the checks of c in parallel and combines their results
+// according to its check_mode. Without a check key this is CheckRoute.
+func CheckHost(c config.HostConfig, proxy *config.HostConfig) ServerHealth {
+	if len(c.Checks) == 0 {
+		return CheckRoute(c, proxy)
+	}
+	checkers := Checkers(c)
+	results := make([]ServerHealth, len(checkers))
+	var wg sync.WaitGroup
+	for i, k := range checkers {
+		wg.Go(func() { results[i] = k.Check(c, proxy) })
+	}
+	wg.Wait()
+	return combine(c.CheckMode, checkers, results)
+}
+
+// combine merges the results of the checks of one host. The SSH check, if
+// it ran, provides the stages, banner and host key shown in the details.
+// With mode all the first failing check decides the status, with any one
+// passing check is enough. A host key mismatch is never outvoted.
+func combine(mode string, checkers []Checker, results []ServerHealth) ServerHealth {
+	h := results[0]
+	for i, k := range checkers {
+		if _, ok := k.(sshCheck); ok {
+			h = results[i]
+			break
+		}
+	}
+
+	h.Checks = nil
+	failed, passed := -1, 0
+	for i, r := range results {
+		h.Checks = append(h.Checks, CheckResult{Name: checkers[i].Name(), Status: r.Status, Error: r.Error})
+		switch {
+		case r.Status == StatusOnline:
+			passed++
+		case failed < 0 || r.Status == StatusHostKeyMismatch:
+			failed = i
+		}
+	}
+
+	if failed < 0 || mode == config.CheckModeAny && passed > 0 && results[failed].Status != StatusHostKeyMismatch {
+		h.Status, h.Error, h.Class, h.Failed = StatusOnline, nil, "", StageNone
+		return h
+	}
+	f := results[failed]
+	h.Status, h.Class, h.Failed = f.Status, f.Class, f.Failed
+	h.Error = fmt.Errorf("%s: %w", checkers[failed].Name(), f.Error)
+	return h
+}
+
+// named gives checkers the name of the check value they were made from
+type named struct {
+	spec config.CheckSpec
+}
+
+func (n named) Name() string {
+	return n.spec.String()
+}
+
+// routeHealth starts the result of a check going c's way
+func routeHealth(c config.HostConfig) ServerHealth {
+	route := "direct"
+	if c.Proxy != "" {
+		route = "via " + c.Proxy
+	}
+	return ServerHealth{Alias: c.Alias, Route: route}
+}
+
+// missingProxy returns the error of a check of c when its proxy is not in
+// proxies.conf
+func missingProxy(c config.HostConfig, proxy *config.HostConfig) error {
+	if c.Proxy != "" && proxy == nil {
+		return fmt.Errorf("proxy %s not found in proxies.conf", c.Proxy)
+	}
+	return nil
+}
+
+// dialStatus is the status of a check whose connection failed with err
+func dialStatus(err error) ServerStatus {
+	if errors.Is(err, ErrProxyAuth) {
+		return StatusAuthFailed
+	}
+	return StatusOffline
+}
+
+// sshCheck is the staged SSH handshake of CheckRoute
+type sshCheck struct{ named }
+
+func (sshCheck) Check(c config.HostConfig, proxy *config.HostConfig) ServerHealth {
+	return CheckRoute(c, proxy)
+}
+
+// tcpCheck connects to a port, the host's own by default
+type tcpCheck struct{ named }
+
+func (k tcpCheck) Check(c config.HostConfig, proxy *config.HostConfig) ServerHealth {
+	h := routeHealth(c)
+	if err := missingProxy(c, proxy); err != nil {
+		return h.fail(StageNone, StatusOffline, err)
+	}
+	port := k.spec.Port
+	if port == "" {
+		port = cmdPort(c.Port)
+	}
+
+	start := time.Now()
+	conn, err := Dial(proxy, net.JoinHostPort(c.Host, port), checkTimeout)
+	if err != nil {
+		return h.fail(StageTCP, dialStatus(err), err)
+	}
+	conn.Close()
+	h.done(StageTCP, time.Since(start))
+	h.Status = StatusOnline
+	return h
+}
+
+// icmpCheck pings the host. Proxies can't carry ICMP, so it is always direct.
+type icmpCheck struct{ named }
+
+func (icmpCheck) Check(c config.HostConfig, _ *config.HostConfig) ServerHealth {
+	h := ServerHealth{Alias: c.Alias, Route: "direct"}
+	if !checkPing(c.Host) {
+		return h.fail(StageNone, StatusOffline, fmt.Errorf("no reply to ping from %s", c.Host))
+	}
+	h.Status = StatusOnline
+	return h
+}
+
+// httpCheck GETs a URL through the host's proxy and expects a status code.
+// Redirects are not followed, so they can be expected too.
+type httpCheck struct{ named }
+
+func (k httpCheck) Check(c config.HostConfig, proxy *config.HostConfig) ServerHealth {
+	h := routeHealth(c)
+	if err := missingProxy(c, proxy); err != nil {
+		return h.fail(StageNone, StatusOffline, err)
+	}
+
+	transport := &http.Transport{
+		DialContext: func(_ context.Context, _, addr string) (net.Conn, error) {
+			return Dial(proxy, addr, checkTimeout)
+		},
+		TLSHandshakeTimeout: checkTimeout,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   checkTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(k.spec.URL)
+	if err != nil {
+		return h.fail(StageNone, dialStatus(err), err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != k.spec.Status {
+		return h.fail(StageNone, StatusDegraded, fmt.Errorf("%s returned %s, expected %d", k.spec.URL, resp.Status, k.spec.Status))
+	}
+	h.Status = StatusOnline
+	return h
+}
+
+// commandCheck runs a local command with the host in MUX_SSH_ALIAS,
+// MUX_SSH_HOST and MUX_SSH_PORT. Exit codes follow Nagios plugins: 0 is
+// online, 1 (warning) degraded and anything else offline.
+type commandCheck struct{ named }
+
+func (k commandCheck) Check(c config.HostConfig, _ *config.HostConfig) ServerHealth {
+	h := ServerHealth{Alias: c.Alias, Route: "local command"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+	cmd := shellCommand(ctx, k.spec.Command)
+	cmd.Env = append(os.Environ(), "MUX_SSH_ALIAS="+c.Alias, "MUX_SSH_HOST="+c.Host, "MUX_SSH_PORT="+cmdPort(c.Port))
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return h.fail(StageNone, StatusOffline, fmt.Errorf("timed out after %s: %w", CommandTimeout, ctx.Err()))
+	}
+	if err == nil {
+		h.Status = StatusOnline
+		return h
+	}
+
+	// Plugins explain themselves on their first line
+	msg, _, _ := strings.Cut(strings.TrimSpace(out.String()), "\n")
+	if msg != "" {
+		err = fmt.Errorf("%w: %s", err, msg)
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return h.fail(StageNone, StatusDegraded, err)
+	}
+	return h.fail(StageNone, StatusOffline, err)
+}
@@ -0,0 +1,100 @@
+package ssh
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"ssh-ogm/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestCheckHost(t *testing.T) {
+	host, port, _ := startTestServer(t)
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/healthz", http.StatusFound)
+			return
+		}
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+			return
+		}
+	}))
+	defer web.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, closedPort, _ := net.SplitHostPort(closed.Addr().String())
+	closed.Close()
+
+	tests := []struct {
+		check string
+		want  ServerStatus
+	}{
+		{"ssh", StatusOnline},
+		{"tcp", StatusOnline},
+		{"tcp " + closedPort, StatusOffline},
+		{"http " + web.URL + "/healthz", StatusOnline},
+		{"http " + web.URL + "/moved 302", StatusOnline},
+		{"http " + web.URL + "/missing", StatusDegraded},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, []struct {
+			check string
+			want  ServerStatus
+		}{
+			{`command test "$MUX_SSH_HOST:$MUX_SSH_PORT" = ` + host + ":" + port, StatusOnline},
+			{"command echo 'WARNING - replication lag'; exit 1", StatusDegraded},
+			{"command exit 2", StatusOffline},
+		}...)
+	}
+	for _, tt := range tests {
+		c := config.HostConfig{Alias: "t", Host: host, Port: port}
+		if err := c.Set("check", tt.check); err != nil {
+			t.Fatal(err)
+		}
+		health := CheckHost(c, nil)
+		if health.Status != tt.want {
+			t.Errorf("%s: got %s (%v), want %s", tt.check, health.Status, health.Error, tt.want)
+		}
+		if len(health.Checks) != 1 || health.Checks[0].Name != c.Checks[0] {
+			t.Errorf("%s: results %+v", tt.check, health.Checks)
+		}
+	}
+
+	c := config.HostConfig{Alias: "t", Host: host, Port: port, Proxy: "gone", Checks: []string{"tcp"}}
+	if health := CheckHost(c, nil); health.Status != StatusOffline || !strings.Contains(health.Error.Error(), "not found") {
+		t.Errorf("missing proxy: got %s (%v)", health.Status, health.Error)
+	}
+}
+
+func TestCombine(t *testing.T) {
+	checkers := []Checker{
+		NewChecker(config.CheckSpec{Kind: config.CheckTCP, Port: "443"}),
+		NewChecker(config.CheckSpec{Kind: config.CheckSSH}),
+	}
+	sshResult := ServerHealth{Alias: "t", Status: StatusOnline, Banner: "SSH-2.0-Go"}
+	refused := ServerHealth{Alias: "t", Status: StatusOffline, Error: errors.New("connection refused")}
+
+	health := combine(config.CheckModeAll, checkers, []ServerHealth{refused, sshResult})
+	if health.Status != StatusOffline || health.Error.Error() != "tcp 443: connection refused" {
+		t.Errorf("all: got %s (%v)", health.Status, health.Error)
+	}
+	if health.Banner != "SSH-2.0-Go" || len(health.Checks) != 2 || health.Checks[1].Name != "ssh" {
+		t.Errorf("all: details should come from the ssh check: %+v", health)
+	}
+
+	if health := combine(config.CheckModeAny, checkers, []ServerHealth{refused, sshResult}); health.Status != StatusOnline || health.Error != nil {
+		t.Errorf("any: got %s (%v)", health.Status, health.Error)
+	}
+
+	mismatch := ServerHealth{Alias: "t", Status: StatusHostKeyMismatch, Error: errHostKeyMismatch}
+	online := ServerHealth{Alias: "t", Status: StatusOnline}
+	if health := combine(config.CheckModeAny, checkers, []ServerHealth{online, mismatch}); health.Status != StatusHostKeyMismatch {
+		t.Errorf("a passing check outvoted a host key mismatch: got %s", health.Status)
+	}
+}
@@ -0,0 +1,244 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"ssh-ogm/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandTimeout bounds how long a password_command or identity_command may run
+var CommandTimeout = 20 * time.Second
+
+// FailureRetry is how long a failed password_command or identity_command
+// is remembered before the next caller runs it again
+var FailureRetry = 30 * time.Second
+
+// SecretLookup resolves "secret:" references in passwords. main wires it
+// to the config vault; when nil such values are used as-is.
+var SecretLookup func(value string) (string, error)
+
+// Command results are cached for the lifetime of the process so external
+// managers are asked at most once per command line. Failures only last
+// FailureRetry, so an unlocked manager or a network blip doesn't leave
+// hosts unusable until restart.
+// credMu only guards the maps: the commands themselves run unlocked, so
+// parallel checks of hosts with different commands don't wait on each other.
+var (
+	credMu      sync.Mutex
+	passwords   = make(map[string]*secretResult)
+	identities  = make(map[string]*secretResult)
+	identityDir string
+	tempFiles   []string
+)
+
+// secretResult is the latest outcome of a command line
+type secretResult struct {
+	mu     sync.Mutex
+	ran    bool
+	value  string
+	err    error
+	failed time.Time
+}
+
+// cachedSecret returns the result of run for command, running it only if no
+// earlier call succeeded or failed less than FailureRetry ago. Concurrent
+// callers for the same command wait for the one running it.
+func cachedSecret(cache map[string]*secretResult, command string, run func() (string, error)) (string, error) {
+	credMu.Lock()
+	r, ok := cache[command]
+	if !ok {
+		r = &secretResult{}
+		cache[command] = r
+	}
+	credMu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.ran || (r.err != nil && time.Since(r.failed) >= FailureRetry) {
+		r.value, r.err = run()
+		r.ran = true
+		r.failed = time.Now()
+	}
+	return r.value, r.err
+}
+
+// Password returns the password configured for h, running its
+// password_command or resolving a vault reference if needed.
+func Password(h config.HostConfig) (string, error) {
+	if h.PasswordCommand != "" {
+		pw, err := cachedSecret(passwords, h.PasswordCommand, func() (string, error) {
+			out, err := runSecretCommand(h.PasswordCommand)
+			if err != nil {
+				return "", err
+			}
+			// Only the line terminator is stripped, passwords may legitimately contain spaces
+			return strings.TrimRight(string(out), "\r\n"), nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("password_command for %s: %w", h.Alias, err)
+		}
+		return pw, nil
+	}
+
+	if SecretLookup != nil && h.Password != "" {
+		return SecretLookup(h.Password)
+	}
+	return h.Password, nil
+}
+
+// IdentityFile returns the private key path for h. With identity_command
+// set, the key is written to a private temporary file that lives until Cleanup.
+func IdentityFile(h config.HostConfig) (string, error) {
+	if h.IdentityCommand == "" {
+		return h.IdentityFile, nil
+	}
+
+	path, err := cachedSecret(identities, h.IdentityCommand, func() (string, error) {
+		out, err := runSecretCommand(h.IdentityCommand)
+		if err != nil {
+			return "", err
+		}
+		return writeIdentity(out)
+	})
+	if err != nil {
+		return "", fmt.Errorf("identity_command for %s: %w", h.Alias, err)
+	}
+	return path, nil
+}
+
+// writeIdentity stores key in a new private file under identityDir
+func writeIdentity(key []byte) (string, error) {
+	credMu.Lock()
+	if identityDir == "" {
+		dir, err := os.MkdirTemp("", "mux-ssh-keys-")
+		if err != nil {
+			credMu.Unlock()
+			return "", err
+		}
+		identityDir = dir
+	}
+	dir := identityDir
+	credMu.Unlock()
+
+	f, err := os.CreateTemp(dir, "id-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	// ssh refuses keys that other users can read
+	if err := f.Chmod(0600); err != nil {
+		return "", err
+	}
+	if !bytes.HasSuffix(key, []byte("\n")) {
+		key = append(key, '\n')
+	}
+	if _, err := f.Write(key); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Cleanup removes key material fetched by identity_command and other
+// temporary files handed to ssh
+func Cleanup() {
+	credMu.Lock()
+	defer credMu.Unlock()
+
+	if identityDir != "" {
+		os.RemoveAll(identityDir)
+		identityDir = ""
+	}
+	identities = make(map[string]*secretResult)
+	for _, f := range tempFiles {
+		os.Remove(f)
+	}
+	tempFiles = nil
+}
+
+// writeSecretFile stores secret in a new file only we can read, removed by
+// Cleanup
+func writeSecretFile(prefix, secret string) (string, error) {
+	f, err := os.CreateTemp("", prefix)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	trackTempFile(f.Name())
+	if err := f.Chmod(0600); err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(secret); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// trackTempFile registers path for removal by Cleanup
+func trackTempFile(path string) {
+	credMu.Lock()
+	defer credMu.Unlock()
+	tempFiles = append(tempFiles, path)
+}
+
+// runSecretCommand runs a command line through the shell and returns its
+// stdout. The output is never included in errors.
+func runSecretCommand(command string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), CommandTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out after %s", CommandTimeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			msg = msg[:i]
+		}
+		if msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("command printed nothing")
+	}
+	return stdout.Bytes(), nil
+}
+
+// shellCommand prepares a command line to run through the shell, from the
+// config directory so relative script paths are resolved against it.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if dir := filepath.Join(home, config.DirName); isDir(dir) {
+			cmd.Dir = dir
+		}
+	}
+	// Don't wait on grandchildren still holding the pipes after a timeout
+	cmd.WaitDelay = time.Second
+	return cmd
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
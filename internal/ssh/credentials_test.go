@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"ssh-ogm/internal/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPasswordCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	counter := filepath.Join(t.TempDir(), "calls")
+	h := config.HostConfig{
+		Alias:           "p",
+		PasswordCommand: "echo x >> " + counter + "; printf 'pa ss\\n'",
+	}
+
+	for i := 0; i < 2; i++ {
+		pw, err := Password(h)
+		if err != nil {
+			t.Fatalf("Password failed: %v", err)
+		}
+		if pw != "pa ss" {
+			t.Errorf("expected 'pa ss', got %q", pw)
+		}
+	}
+
+	data, _ := os.ReadFile(counter)
+	if n := strings.Count(string(data), "x"); n != 1 {
+		t.Errorf("expected command to run once, ran %d times", n)
+	}
+}
+
+func TestPasswordCommandErrors(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	old := CommandTimeout
+	CommandTimeout = 200 * time.Millisecond
+	defer func() { CommandTimeout = old }()
+
+	if _, err := Password(config.HostConfig{PasswordCommand: "sleep 5"}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+	_, err := Password(config.HostConfig{PasswordCommand: "printf leaked; echo nope >&2; exit 3"})
+	if err == nil || strings.Contains(err.Error(), "leaked") {
+		t.Errorf("expected error without stdout contents, got %v", err)
+	}
+}
+
+func TestPasswordCommandsRunInParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	old := CommandTimeout
+	CommandTimeout = 5 * time.Second
+	defer func() { CommandTimeout = old }()
+
+	// The first command waits for the second, which a global lock would hold back
+	flag := filepath.Join(t.TempDir(), "flag")
+	counter := filepath.Join(t.TempDir(), "calls")
+	waiting := config.HostConfig{Alias: "a", PasswordCommand: "while [ ! -e " + flag + " ]; do sleep 0.01; done; echo a"}
+	signalling := config.HostConfig{Alias: "b", PasswordCommand: "sleep 0.1; touch " + flag + "; echo x >> " + counter + "; exit 1"}
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		if pw, err := Password(waiting); err != nil || pw != "a" {
+			t.Errorf("waiting command: %q, %v", pw, err)
+		}
+	})
+	wg.Go(func() {
+		if _, err := Password(signalling); err == nil {
+			t.Error("expected the signalling command to fail")
+		}
+	})
+	wg.Wait()
+
+	// Failures are remembered for a while
+	if _, err := Password(signalling); err == nil || !strings.Contains(err.Error(), "password_command for b") {
+		t.Errorf("expected the cached failure, got %v", err)
+	}
+	data, _ := os.ReadFile(counter)
+	if n := strings.Count(string(data), "x"); n != 1 {
+		t.Errorf("expected the failing command to run once, ran %d times", n)
+	}
+}
+
+func TestPasswordCommandRetriedAfterFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	old := FailureRetry
+	FailureRetry = 100 * time.Millisecond
+	defer func() { FailureRetry = old }()
+
+	// Fails the first time, like a password manager that is still locked
+	counter := filepath.Join(t.TempDir(), "calls")
+	h := config.HostConfig{Alias: "flaky", PasswordCommand: "if [ -e " + counter + " ]; then echo pw; else touch " + counter + "; exit 1; fi"}
+
+	if _, err := Password(h); err == nil {
+		t.Fatal("expected the first run to fail")
+	}
+	if _, err := Password(h); err == nil {
+		t.Fatal("expected the failure to be remembered before FailureRetry")
+	}
+	time.Sleep(FailureRetry)
+	if pw, err := Password(h); err != nil || pw != "pw" {
+		t.Fatalf("expected a retry to succeed, got %q, %v", pw, err)
+	}
+	// Successes stay cached
+	os.Remove(counter)
+	time.Sleep(FailureRetry)
+	if pw, err := Password(h); err != nil || pw != "pw" {
+		t.Errorf("expected the cached password, got %q, %v", pw, err)
+	}
+}
+
+func TestIdentityCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	defer Cleanup()
+
+	path, err := IdentityFile(config.HostConfig{IdentityCommand: "printf KEY"})
+	if err != nil {
+		t.Fatalf("IdentityFile failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected 0600, got %v", info.Mode().Perm())
+	}
+
+	Cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected key to be removed by Cleanup")
+	}
+}
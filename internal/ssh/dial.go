@@ -0,0 +1,70 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"ssh-ogm/internal/config"
+	"time"
+)
+
+// Dial connects to addr, through proxy when it is not nil
+func Dial(proxy *config.HostConfig, addr string, timeout time.Duration) (net.Conn, error) {
+	if proxy == nil {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+	password, err := Password(*proxy)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", proxy.Alias, err)
+	}
+	return DialProxy(*proxy, password, addr, timeout)
+}
+
+// DialProxy connects to addr through proxy, logging in with password
+// instead of the one proxy configures
+func DialProxy(proxy config.HostConfig, password, addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := dialProxy(proxy, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	tunnel := conn
+	switch proxy.Type {
+	case "http", "https":
+		tunnel, err = httpConnect(conn, proxy, password, addr)
+	default:
+		err = socksHandshake(conn, proxy, password, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxy.Alias, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// dialProxy opens the connection to the proxy itself, including the TLS
+// handshake for https proxies.
+func dialProxy(proxy config.HostConfig, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(proxy.Host, proxy.Port), timeout)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", proxy.Alias, err)
+	}
+	if proxy.Type == "https" {
+		tlsConn, err := tlsProxy(conn, proxy, timeout)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy %s: %w", proxy.Alias, err)
+		}
+		return tlsConn, nil
+	}
+	return conn, nil
+}
+
+// socksHandshake authenticates with the SOCKS5 proxy and connects to addr
+func socksHandshake(conn net.Conn, proxy config.HostConfig, password, addr string) error {
+	if err := socksAuthenticate(conn, proxy.User, password); err != nil {
+		return err
+	}
+	return socksConnect(conn, addr)
+}
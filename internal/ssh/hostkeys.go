@@ -0,0 +1,226 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"ssh-ogm/internal/config"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KnownHostsPath is the known_hosts file shared with the OpenSSH client
+var KnownHostsPath = defaultKnownHostsPath()
+
+func defaultKnownHostsPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// loadKnownHosts parses KnownHostsPath. A missing file knows no hosts.
+func loadKnownHosts() (ssh.HostKeyCallback, error) {
+	if _, err := os.Stat(KnownHostsPath); os.IsNotExist(err) {
+		return func(string, net.Addr, ssh.PublicKey) error {
+			return &knownhosts.KeyError{}
+		}, nil
+	}
+	return knownhosts.New(KnownHostsPath)
+}
+
+// verifyHostKey checks server keys against known_hosts the way OpenSSH does:
+// unknown hosts are confirmed with the user and recorded, changed keys are refused.
+func verifyHostKey(known ssh.HostKeyCallback) ssh.HostKeyCallback {
+	return func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+		// Only the name is looked up, like OpenSSH's default CheckHostIP=no.
+		// Behind a proxy the remote address is the proxy's anyway.
+		err := known(hostname, probeAddr(hostname), key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		fingerprint := ssh.FingerprintSHA256(key)
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key for %s has changed (now %s %s), this could be a man-in-the-middle attack; remove the old entry from %s if the change is expected",
+				hostname, key.Type(), fingerprint, KnownHostsPath)
+		}
+
+		answer, err := Prompt(fmt.Sprintf("The authenticity of host '%s' can't be established.\n%s key fingerprint is %s.\nAre you sure you want to continue connecting (yes/no)? ",
+			hostname, key.Type(), fingerprint), true)
+		if err != nil {
+			return err
+		}
+		if answer != "yes" {
+			return errors.New("host key verification failed")
+		}
+		return addKnownHost(hostname, key)
+	}
+}
+
+// HostKeyState is what known_hosts says about the key a server presented
+type HostKeyState int
+
+const (
+	HostKeyUnchecked HostKeyState = iota // known_hosts could not be read
+	HostKeyKnown
+	HostKeyUnknown
+	HostKeyMismatch // known_hosts has other keys for the host, or revoked this one
+	HostKeyPinned   // Matches a hostkey pin, known_hosts is not consulted
+)
+
+// checkHostKey looks key up in known_hosts without asking or recording anything
+func checkHostKey(known ssh.HostKeyCallback, hostname string, key ssh.PublicKey) HostKeyState {
+	err := known(hostname, probeAddr(hostname), key)
+	var keyErr *knownhosts.KeyError
+	switch {
+	case err == nil:
+		return HostKeyKnown
+	case errors.As(err, &keyErr) && len(keyErr.Want) == 0:
+		return HostKeyUnknown
+	}
+	return HostKeyMismatch
+}
+
+// addKnownHost appends a known_hosts entry for hostname
+func addKnownHost(hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(KnownHostsPath), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(KnownHostsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	return err
+}
+
+// knownHostAlgorithms returns the key algorithms known_hosts has for addr, so
+// the server presents a key that can be verified rather than one of another
+// type that would look like a changed key. It returns nil for unknown hosts.
+func knownHostAlgorithms(known ssh.HostKeyCallback, addr string) []string {
+	var algos []string
+	for _, k := range knownKeys(known, addr) {
+		types := []string{k.Key.Type()}
+		if types[0] == ssh.KeyAlgoRSA {
+			// The same RSA key verifies the SHA-2 signature algorithms
+			types = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, t := range types {
+			if !slices.Contains(algos, t) {
+				algos = append(algos, t)
+			}
+		}
+	}
+	return algos
+}
+
+// knownKeys returns every entry known has for addr, hashed ones included
+func knownKeys(known ssh.HostKeyCallback, addr string) []knownhosts.KnownKey {
+	// A throwaway key never matches, so the error lists every known key
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probe, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if err := known(addr, probeAddr(addr), probe); !errors.As(err, &keyErr) {
+		return nil
+	}
+	return keyErr.Want
+}
+
+// KnownHostKey is a key known_hosts has for a host
+type KnownHostKey struct {
+	Type        string
+	Fingerprint string
+	Line        int
+}
+
+// KnownHostKeys returns the keys in KnownHostsPath for cfg
+func KnownHostKeys(cfg config.HostConfig) ([]KnownHostKey, error) {
+	known, err := loadKnownHosts()
+	if err != nil {
+		return nil, err
+	}
+	var keys []KnownHostKey
+	for _, k := range knownKeys(known, net.JoinHostPort(cfg.Host, cmdPort(cfg.Port))) {
+		keys = append(keys, KnownHostKey{Type: k.Key.Type(), Fingerprint: ssh.FingerprintSHA256(k.Key), Line: k.Line})
+	}
+	return keys, nil
+}
+
+// HostKeyUpdate replaces the known_hosts entries of Host with Keys
+type HostKeyUpdate struct {
+	Host config.HostConfig
+	Keys []ScannedKey // None forgets the host
+}
+
+// UpdateKnownHosts applies updates to KnownHostsPath in a single atomic
+// write and returns how many old entries were removed. Entries listing
+// several hosts are removed as a whole, like ssh-keygen -R does.
+func UpdateKnownHosts(updates []HostKeyUpdate) (int, error) {
+	known, err := loadKnownHosts()
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(KnownHostsPath)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	drop := make(map[int]bool)
+	var added []string
+	for _, u := range updates {
+		addr := net.JoinHostPort(u.Host.Host, cmdPort(u.Host.Port))
+		for _, k := range knownKeys(known, addr) {
+			if k.Filename == KnownHostsPath {
+				drop[k.Line] = true
+			}
+		}
+		for _, k := range u.Keys {
+			added = append(added, knownhosts.Line([]string{knownhosts.Normalize(addr)}, k.Key))
+		}
+	}
+
+	var out strings.Builder
+	if len(data) > 0 {
+		for i, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			if !drop[i+1] {
+				out.WriteString(line + "\n")
+			}
+		}
+	}
+	for _, line := range added {
+		out.WriteString(line + "\n")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(KnownHostsPath), 0700); err != nil {
+		return 0, err
+	}
+	return len(drop), config.WriteFileAtomic(KnownHostsPath, []byte(out.String()))
+}
+
+// ForgetHostKey removes every known_hosts entry for cfg
+func ForgetHostKey(cfg config.HostConfig) (int, error) {
+	return UpdateKnownHosts([]HostKeyUpdate{{Host: cfg}})
+}
+
+// probeAddr is a net.Addr for a host:port string
+type probeAddr string
+
+func (a probeAddr) Network() string { return "tcp" }
+func (a probeAddr) String() string  { return string(a) }
@@ -0,0 +1,109 @@
+package ssh
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"ssh-ogm/internal/config"
+	"strings"
+	"time"
+)
+
+// tlsProxy wraps conn in TLS for https proxies, trusting the proxy's
+// ca_bundle instead of the system roots when one is set.
+func tlsProxy(conn net.Conn, proxy config.HostConfig, timeout time.Duration) (net.Conn, error) {
+	tlsConfig := &tls.Config{ServerName: proxy.Host}
+	if proxy.CABundle != "" {
+		path := proxy.CABundle
+		if rest, ok := strings.CutPrefix(path, "~/"); ok {
+			home, _ := os.UserHomeDir()
+			path = filepath.Join(home, rest)
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ca_bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_bundle %s contains no PEM certificates", proxy.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake: %w", err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// httpConnect asks an HTTP proxy to open a tunnel to addr. It returns the
+// connection to use afterwards, which may hold bytes the proxy sent early.
+func httpConnect(conn net.Conn, proxy config.HostConfig, password, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("reading CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusProxyAuthRequired:
+		if proxy.User == "" {
+			return nil, fmt.Errorf("%w: proxy requires authentication (407)", ErrProxyAuth)
+		}
+		return nil, fmt.Errorf("%w: username or password rejected (407)", ErrProxyAuth)
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("proxy does not allow connections to %s (403 Forbidden)", addr)
+	default:
+		return nil, fmt.Errorf("proxy could not connect to %s: %s", addr, resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		// The SSH banner may have arrived together with the response
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads what is left in r before reading from the connection
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// CloseWrite half-closes the underlying connection when it supports it
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
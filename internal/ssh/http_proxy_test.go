@@ -0,0 +1,142 @@
+package ssh
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"ssh-ogm/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// connectProxy is an HTTP CONNECT proxy requiring alice/secret that refuses
+// tunnels to blocked.example.com.
+func connectProxy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+		return
+	}
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret"))
+	if r.Header.Get("Proxy-Authorization") != want {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="corp"`)
+		w.WriteHeader(http.StatusProxyAuthRequired)
+		return
+	}
+	if strings.HasPrefix(r.Host, "blocked.example.com:") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	target, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer target.Close()
+
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+	buf.Flush()
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func proxyFor(t *testing.T, srv *httptest.Server, proxyType string) config.HostConfig {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	return config.HostConfig{Alias: "gw", Host: host, Port: port, Type: proxyType, User: "alice", Password: "secret"}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(connectProxy))
+	defer srv.Close()
+	proxy := proxyFor(t, srv, "http")
+
+	// The server speaks first, like an SSH banner
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Write([]byte("SSH-2.0-test\r\n"))
+			c.Close()
+		}
+	}()
+
+	conn, err := Dial(&proxy, l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	banner, _ := io.ReadAll(conn)
+	conn.Close()
+	if string(banner) != "SSH-2.0-test\r\n" {
+		t.Errorf("tunnel returned %q", banner)
+	}
+
+	wrong := proxy
+	wrong.Password = "guess"
+	if _, err := Dial(&wrong, l.Addr().String(), time.Second); !errors.Is(err, ErrProxyAuth) || !strings.Contains(err.Error(), "407") {
+		t.Errorf("wrong password: got %v", err)
+	}
+	anonymous := proxy
+	anonymous.User, anonymous.Password = "", ""
+	if _, err := Dial(&anonymous, l.Addr().String(), time.Second); !errors.Is(err, ErrProxyAuth) || !strings.Contains(err.Error(), "requires authentication") {
+		t.Errorf("missing credentials: got %v", err)
+	}
+	_, err = Dial(&proxy, "blocked.example.com:22", time.Second)
+	if err == nil || errors.Is(err, ErrProxyAuth) || !strings.Contains(err.Error(), "403") {
+		t.Errorf("blocked target: got %v", err)
+	}
+}
+
+func TestHTTPSProxy(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	KnownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	defer func() { KnownHostsPath = defaultKnownHostsPath() }()
+	Prompt = func(prompt string, echo bool) (string, error) {
+		if echo {
+			return "yes", nil
+		}
+		return "secret", nil
+	}
+	defer func() { Prompt = promptTerminal }()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(connectProxy))
+	defer srv.Close()
+	proxy := proxyFor(t, srv, "https")
+	host, port, _ := startTestServer(t)
+	target := config.HostConfig{Alias: "t", Host: host, Port: port, User: "bob"}
+
+	// The test certificate is not in the system roots
+	if _, err := dialNative(target, &proxy); err == nil || !strings.Contains(err.Error(), "TLS handshake") {
+		t.Errorf("expected a TLS verification error, got %v", err)
+	}
+	if status := CheckProxy(proxy); status != StatusOffline {
+		t.Errorf("CheckProxy with an untrusted certificate = %s", status)
+	}
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	proxy.CABundle = bundle
+	client, err := dialNative(target, &proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if status := CheckProxy(proxy); status != StatusOnline {
+		t.Errorf("CheckProxy with ca_bundle = %s", status)
+	}
+}
@@ -0,0 +1,131 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"ssh-ogm/internal/config"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// scanAlgorithms are the host key types a scan asks for, one handshake each.
+// RSA keys are requested with SHA-2 signatures, the key is the same.
+var scanAlgorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoECDSA384,
+	ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512,
+}
+
+// errScanned aborts a scan handshake once the server has shown its key
+var errScanned = errors.New("host key received")
+
+// ScannedKey is a host key presented by a server
+type ScannedKey struct {
+	Key         ssh.PublicKey
+	Type        string
+	Fingerprint string
+}
+
+// ScanHostKeys collects every host key cfg's server has, connecting along
+// the same route as a connection would. Like ssh-keyscan, nothing is verified.
+func ScanHostKeys(cfg config.HostConfig, proxyCfg *config.HostConfig) ([]ScannedKey, error) {
+	addr := net.JoinHostPort(cfg.Host, cmdPort(cfg.Port))
+
+	var keys []ScannedKey
+	var lastErr error
+	for _, algo := range scanAlgorithms {
+		key, err := scanHostKey(proxyCfg, addr, algo)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		keys = append(keys, ScannedKey{Key: key, Type: key.Type(), Fingerprint: ssh.FingerprintSHA256(key)})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("scanning %s: %w", cfg.Alias, lastErr)
+	}
+	return keys, nil
+}
+
+// scanHostKey runs a handshake offering only algo and returns the server's key
+func scanHostKey(proxyCfg *config.HostConfig, addr, algo string) (ssh.PublicKey, error) {
+	conn, err := Dial(proxyCfg, addr, checkTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(checkTimeout))
+
+	var key ssh.PublicKey
+	_, _, _, err = ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:              "mux-ssh",
+		HostKeyAlgorithms: []string{algo},
+		HostKeyCallback: func(_ string, _ net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errScanned
+		},
+	})
+	if key == nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// isPinned reports whether key's fingerprint is one of pins
+func isPinned(pins []string, key ssh.PublicKey) bool {
+	return slices.Contains(pins, ssh.FingerprintSHA256(key))
+}
+
+// verifyPinned accepts only host keys pinned with the hostkey key.
+// known_hosts is neither consulted nor updated for such hosts.
+func verifyPinned(alias string, pins []string) ssh.HostKeyCallback {
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		if isPinned(pins, key) {
+			return nil
+		}
+		return fmt.Errorf("host key %s %s is not pinned for %s, this could be a man-in-the-middle attack; run 'mux-ssh pin %s' if the key changed on purpose",
+			key.Type(), ssh.FingerprintSHA256(key), alias, alias)
+	}
+}
+
+// pinnedKnownHosts writes a temporary known_hosts holding the pinned keys of
+// cfg, for the ssh binary to verify against. The file lives until Cleanup.
+func pinnedKnownHosts(cfg config.HostConfig, proxyCfg *config.HostConfig) (string, error) {
+	scanned, err := ScanHostKeys(cfg, proxyCfg)
+	if err != nil {
+		return "", err
+	}
+	// ssh looks the host up by the name it was given, with the port if not 22
+	name := knownhosts.Normalize(net.JoinHostPort(cfg.Host, cmdPort(cfg.Port)))
+	var lines []string
+	var presented []string
+	for _, k := range scanned {
+		presented = append(presented, k.Type+" "+k.Fingerprint)
+		if isPinned(cfg.HostKeys, k.Key) {
+			lines = append(lines, knownhosts.Line([]string{name}, k.Key))
+		}
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("none of the host keys of %s are pinned (server has %s), this could be a man-in-the-middle attack; run 'mux-ssh pin %s' if the keys changed on purpose",
+			cfg.Alias, strings.Join(presented, ", "), cfg.Alias)
+	}
+
+	f, err := os.CreateTemp("", "mux-ssh-known_hosts-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	trackTempFile(f.Name())
+	if _, err := f.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
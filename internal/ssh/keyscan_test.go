@@ -0,0 +1,113 @@
+package ssh
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"ssh-ogm/internal/config"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestScanHostKeys(t *testing.T) {
+	host, port, hostKey := startTestServer(t)
+	keys, err := ScanHostKeys(config.HostConfig{Alias: "t", Host: host, Port: port}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The test server only has an ed25519 key
+	if len(keys) != 1 || keys[0].Fingerprint != ssh.FingerprintSHA256(hostKey.PublicKey()) {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+}
+
+func TestHostKeyPins(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	KnownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	defer func() { KnownHostsPath = defaultKnownHostsPath() }()
+	Prompt = func(string, bool) (string, error) { return "secret", nil }
+	defer func() { Prompt = promptTerminal }()
+
+	host, port, hostKey := startTestServer(t)
+	good := config.HostConfig{Alias: "t", Host: host, Port: port, User: "bob",
+		HostKeys: []string{"SHA256:retired", ssh.FingerprintSHA256(hostKey.PublicKey())}}
+	bad := good
+	bad.HostKeys = []string{"SHA256:retired"}
+
+	if health := CheckRoute(good, nil); health.Status != StatusOnline || health.KeyState != HostKeyPinned {
+		t.Errorf("pinned key: got %s, key state %d (%v)", health.Status, health.KeyState, health.Error)
+	}
+	if health := CheckRoute(bad, nil); health.Status != StatusHostKeyMismatch {
+		t.Errorf("unpinned key: got %s", health.Status)
+	}
+
+	// Pinned hosts never prompt for or record unknown keys
+	client, err := dialNative(good, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if _, err := os.Stat(KnownHostsPath); !os.IsNotExist(err) {
+		t.Error("known_hosts was written for a pinned host")
+	}
+	if _, err := dialNative(bad, nil); err == nil || !strings.Contains(err.Error(), "not pinned") {
+		t.Errorf("expected a pin error, got %v", err)
+	}
+
+	path, err := pinnedKnownHosts(good, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "["+host+"]:"+port+" ssh-ed25519 ") {
+		t.Errorf("unexpected known_hosts %q", data)
+	}
+	Cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Cleanup left the temporary known_hosts behind")
+	}
+	if _, err := pinnedKnownHosts(bad, nil); err == nil {
+		t.Error("expected an error when no key is pinned")
+	}
+}
+
+func TestUpdateKnownHosts(t *testing.T) {
+	KnownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	defer func() { KnownHostsPath = defaultKnownHostsPath() }()
+
+	host, port, hostKey := startTestServer(t)
+	cfg := config.HostConfig{Alias: "t", Host: host, Port: port}
+	addr := knownhosts.Normalize(net.JoinHostPort(host, port))
+	other := knownhosts.Line([]string{"other.example.com"}, newHostKey(t).PublicKey())
+	stale := knownhosts.Line([]string{knownhosts.HashHostname(addr)}, newHostKey(t).PublicKey())
+	os.WriteFile(KnownHostsPath, []byte("# keep me\n"+other+"\n"+stale+"\n"), 0600)
+
+	old, err := KnownHostKeys(cfg)
+	if err != nil || len(old) != 1 || old[0].Line != 3 {
+		t.Fatalf("expected the hashed entry on line 3, got %+v (%v)", old, err)
+	}
+	scanned, err := ScanHostKeys(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := UpdateKnownHosts([]HostKeyUpdate{{Host: cfg, Keys: scanned}})
+	if err != nil || removed != 1 {
+		t.Fatalf("removed %d, %v", removed, err)
+	}
+	data, _ := os.ReadFile(KnownHostsPath)
+	want := "# keep me\n" + other + "\n" + knownhosts.Line([]string{addr}, hostKey.PublicKey()) + "\n"
+	if string(data) != want {
+		t.Errorf("known_hosts is\n%s\nwant\n%s", data, want)
+	}
+
+	if removed, err := ForgetHostKey(cfg); err != nil || removed != 1 {
+		t.Errorf("forget removed %d, %v", removed, err)
+	}
+	if keys, _ := KnownHostKeys(cfg); len(keys) != 0 {
+		t.Errorf("host still known: %+v", keys)
+	}
+}
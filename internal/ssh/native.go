@@ -0,0 +1,376 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"ssh-ogm/internal/config"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ClientEnv selects the client for hosts without a client key,
+// e.g. MUX_SSH_CLIENT=native
+const ClientEnv = "MUX_SSH_CLIENT"
+
+// DialTimeout bounds establishing the TCP connection and SSH handshake
+var DialTimeout = 15 * time.Second
+
+// Prompt asks the user for input on the terminal. echo is false for
+// passwords and passphrases. Tests replace it.
+var Prompt = promptTerminal
+
+// ClientFor returns which client connects to cfg: its client key, then
+// $MUX_SSH_CLIENT, falling back to the native client without an ssh binary.
+func ClientFor(cfg config.HostConfig) string {
+	if _, err := exec.LookPath("ssh"); err != nil {
+		return config.ClientNative
+	}
+	if cfg.Client != "" {
+		return cfg.Client
+	}
+	if env := os.Getenv(ClientEnv); env == config.ClientNative || env == config.ClientOpenSSH {
+		return env
+	}
+	return config.ClientOpenSSH
+}
+
+// connectNative opens an interactive session with the built-in client
+func connectNative(cfg config.HostConfig, proxyCfg *config.HostConfig) error {
+	client, err := dialNative(cfg, proxyCfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return runSession(client, cfg)
+}
+
+// dialNative connects and authenticates to cfg
+func dialNative(cfg config.HostConfig, proxyCfg *config.HostConfig) (*ssh.Client, error) {
+	username := loginUser(cfg)
+	addr := net.JoinHostPort(cfg.Host, cmdPort(cfg.Port))
+
+	known, err := loadKnownHosts()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", KnownHostsPath, err)
+	}
+	auth, closeAgent, err := authMethods(cfg, username)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+
+	clientConfig := &ssh.ClientConfig{
+		User:              username,
+		Auth:              auth,
+		HostKeyCallback:   verifyHostKey(known),
+		HostKeyAlgorithms: knownHostAlgorithms(known, addr),
+		Timeout:           DialTimeout,
+	}
+	if len(cfg.HostKeys) > 0 {
+		clientConfig.HostKeyCallback = verifyPinned(cfg.Alias, cfg.HostKeys)
+		clientConfig.HostKeyAlgorithms = nil
+	}
+
+	conn, err := Dial(proxyCfg, addr, DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// authMethods returns the agent, key and password methods in the order
+// OpenSSH tries them. The returned func closes the agent connection.
+func authMethods(cfg config.HostConfig, username string) ([]ssh.AuthMethod, func(), error) {
+	identity, err := IdentityFile(cfg)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	keys, closeAgent := publicKeys(identity, func(path string) (string, error) {
+		return Prompt(fmt.Sprintf("Enter passphrase for key '%s': ", path), false)
+	})
+	methods := []ssh.AuthMethod{keys}
+
+	password := func() (string, error) {
+		if cfg.Password != "" || cfg.PasswordCommand != "" {
+			return Password(cfg)
+		}
+		return Prompt(fmt.Sprintf("%s@%s's password: ", username, cfg.Host), false)
+	}
+	methods = append(methods,
+		ssh.RetryableAuthMethod(ssh.PasswordCallback(password), 3),
+		ssh.RetryableAuthMethod(ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			if instruction != "" {
+				fmt.Fprintln(os.Stderr, instruction)
+			}
+			answers := make([]string, len(questions))
+			for i, q := range questions {
+				var err error
+				if answers[i], err = Prompt(q, echos[i]); err != nil {
+					return nil, err
+				}
+			}
+			return answers, nil
+		}), 3),
+	)
+	return methods, closeAgent, nil
+}
+
+// probeAuthMethods returns the methods of authMethods that need no
+// terminal: the agent, unencrypted keys and configured passwords. The
+// password is tried twice, as some servers turn down a first attempt, but
+// no more, since every failure counts towards tools like fail2ban.
+func probeAuthMethods(cfg config.HostConfig) ([]ssh.AuthMethod, func(), error) {
+	identity, err := IdentityFile(cfg)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	keys, closeAgent := publicKeys(identity, nil)
+	methods := []ssh.AuthMethod{keys}
+	if cfg.Password != "" || cfg.PasswordCommand != "" {
+		methods = append(methods, ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+			return Password(cfg)
+		}), 2))
+	}
+	return methods, closeAgent, nil
+}
+
+// publicKeys offers the keys of the running ssh-agent, then those of
+// identity, as a single method: the SSH library tries each method once, so
+// a second publickey method would never run. Encrypted identity keys are
+// unlocked with passphrase, or skipped when it is nil or the agent already
+// holds them. The returned func closes the agent connection.
+func publicKeys(identity string, passphrase func(path string) (string, error)) (ssh.AuthMethod, func()) {
+	agentKeys, closeAgent := agentSigners()
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		// A broken agent must not hide the identity
+		signers, _ := agentKeys()
+		keys, err := identitySigners(identity, func(path string) (string, error) {
+			if passphrase == nil || inAgent(signers, path) {
+				return "", errSkipKey
+			}
+			return passphrase(path)
+		})
+		if err != nil && len(signers) == 0 {
+			return nil, err
+		}
+		return append(signers, keys...), nil
+	}), closeAgent
+}
+
+// agentSigners returns the key lister of the running ssh-agent, if any,
+// and a func closing the connection to it
+func agentSigners() (func() ([]ssh.Signer, error), func()) {
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" && runtime.GOOS != "windows" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			return agent.NewClient(conn).Signers, func() { conn.Close() }
+		}
+	}
+	return func() ([]ssh.Signer, error) { return nil, nil }, func() {}
+}
+
+// inAgent reports whether the public half of the key at path, read from
+// path.pub, is one of signers
+func inAgent(signers []ssh.Signer, path string) bool {
+	data, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		return false
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(signers, func(s ssh.Signer) bool {
+		return bytes.Equal(s.PublicKey().Marshal(), pub.Marshal())
+	})
+}
+
+// errSkipKey is returned by passphrase funcs to leave an encrypted key out
+var errSkipKey = errors.New("key skipped")
+
+// identitySigners loads the configured identity, or the default keys in
+// ~/.ssh when none is set. Encrypted keys are unlocked with the answer of
+// passphrase, or skipped when it is nil or returns errSkipKey.
+func identitySigners(identity string, passphrase func(path string) (string, error)) ([]ssh.Signer, error) {
+	home, _ := os.UserHomeDir()
+	var paths []string
+	if identity != "" {
+		if rest, ok := strings.CutPrefix(identity, "~/"); ok {
+			identity = filepath.Join(home, rest)
+		}
+		paths = []string{identity}
+	} else {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			paths = append(paths, filepath.Join(home, ".ssh", name))
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			if identity != "" {
+				return nil, err
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			if passphrase == nil {
+				continue
+			}
+			pass, perr := passphrase(p)
+			if perr == errSkipKey {
+				continue
+			}
+			if perr != nil {
+				return nil, perr
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(pass))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// runSession starts the host's command or a login shell on a PTY wired to
+// the local terminal and waits for it to finish.
+func runSession(client *ssh.Client, cfg config.HostConfig) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// Like OpenSSH, variables the server's AcceptEnv rejects are silently dropped
+	for name, value := range sessionEnv(cfg, os.Environ()) {
+		session.Setenv(name, value)
+	}
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := os.Stdin.Fd()
+	if term.IsTerminal(fd) {
+		width, height, err := term.GetSize(os.Stdout.Fd())
+		if err != nil {
+			width, height = 80, 24
+		}
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+		modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 14400, ssh.TTY_OP_OSPEED: 14400}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return fmt.Errorf("requesting a terminal: %w", err)
+		}
+
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+
+		stop := watchResize(session, os.Stdout.Fd())
+		defer stop()
+	}
+
+	if command := RemoteCommand(cfg); command != "" {
+		err = session.Start(command)
+	} else {
+		err = session.Shell()
+	}
+	if err != nil {
+		return err
+	}
+	return session.Wait()
+}
+
+// sessionEnv returns the env values of cfg plus the local variables
+// matching its send_env patterns.
+func sessionEnv(cfg config.HostConfig, environ []string) map[string]string {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		for _, pattern := range cfg.SendEnv {
+			if ok, _ := path.Match(pattern, name); ok {
+				env[name] = value
+			}
+		}
+	}
+	for _, kv := range cfg.Env {
+		name, value, _ := strings.Cut(kv, "=")
+		env[name] = value
+	}
+	return env
+}
+
+// loginUser returns the user a connection to cfg logs in as
+func loginUser(cfg config.HostConfig) string {
+	if cfg.User != "" {
+		return cfg.User
+	}
+	return localUser()
+}
+
+// localUser returns the login name OpenSSH would default to
+func localUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return os.Getenv("USER")
+	}
+	// Windows reports DOMAIN\user
+	if i := strings.LastIndexByte(u.Username, '\\'); i >= 0 {
+		return u.Username[i+1:]
+	}
+	return u.Username
+}
+
+// promptTerminal reads a line from stdin, hiding it unless echo is set
+func promptTerminal(prompt string, echo bool) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if !echo {
+		b, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+
+	// Read byte by byte so nothing meant for the session gets buffered here
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				break
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line)), nil
+}
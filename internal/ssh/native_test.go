@@ -0,0 +1,266 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"ssh-ogm/internal/config"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startTestServer runs an SSH server on localhost accepting the password
+// "secret". exec requests echo the command and the env they received.
+func startTestServer(t *testing.T) (host, port string, hostKey ssh.Signer) {
+	t.Helper()
+	hostKey = newHostKey(t)
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	host, port = serveTest(t, cfg, hostKey)
+	return host, port, hostKey
+}
+
+// serveTest runs an SSH server with cfg and hostKey on localhost
+func serveTest(t *testing.T, cfg *ssh.ServerConfig, hostKey ssh.Signer) (host, port string) {
+	t.Helper()
+	cfg.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestConn(conn, cfg)
+		}
+	}()
+
+	host, port, _ = net.SplitHostPort(l.Addr().String())
+	return host, port
+}
+
+func newHostKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func serveTestConn(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			var env []string
+			for req := range requests {
+				switch req.Type {
+				case "env":
+					var kv struct{ Name, Value string }
+					ssh.Unmarshal(req.Payload, &kv)
+					env = append(env, kv.Name+"="+kv.Value)
+					req.Reply(true, nil)
+				case "exec":
+					var cmd struct{ Command string }
+					ssh.Unmarshal(req.Payload, &cmd)
+					req.Reply(true, nil)
+					ch.Write([]byte(cmd.Command + " " + strings.Join(env, " ")))
+					ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					return
+				default:
+					req.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+func TestDialNative(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	KnownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	defer func() { KnownHostsPath = defaultKnownHostsPath() }()
+
+	var prompts []string
+	Prompt = func(prompt string, echo bool) (string, error) {
+		prompts = append(prompts, prompt)
+		if echo {
+			return "yes", nil
+		}
+		return "secret", nil
+	}
+	defer func() { Prompt = promptTerminal }()
+
+	host, port, _ := startTestServer(t)
+	cfg := config.HostConfig{Alias: "t", Host: host, Port: port, User: "alice"}
+
+	// First contact asks about the unknown key and records it
+	client, err := dialNative(cfg, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v (prompts %q)", err, prompts)
+	}
+	session, _ := client.NewSession()
+	session.Setenv("A", "1")
+	out, err := session.Output("uptime")
+	client.Close()
+	if err != nil || string(out) != "uptime A=1" {
+		t.Errorf("exec returned %q, %v", out, err)
+	}
+	if len(prompts) != 2 || !strings.Contains(prompts[0], "authenticity") {
+		t.Errorf("expected a host key and a password prompt, got %q", prompts)
+	}
+	data, _ := os.ReadFile(KnownHostsPath)
+	if !strings.Contains(string(data), "ssh-ed25519") {
+		t.Fatalf("host key not recorded: %q", data)
+	}
+
+	// Known now, only the password is asked
+	prompts = nil
+	client, err = dialNative(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if len(prompts) != 1 {
+		t.Errorf("expected only a password prompt, got %q", prompts)
+	}
+
+	// A different key for the same address is refused
+	os.WriteFile(KnownHostsPath, []byte(knownhosts.Line([]string{knownhosts.Normalize(net.JoinHostPort(host, port))}, newHostKey(t).PublicKey())+"\n"), 0600)
+	if _, err = dialNative(cfg, nil); err == nil || !strings.Contains(err.Error(), "has changed") {
+		t.Errorf("expected a changed host key error, got %v", err)
+	}
+}
+
+func TestAgentAndIdentity(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix socket agent on windows")
+	}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	KnownHostsPath = filepath.Join(dir, "known_hosts")
+	defer func() { KnownHostsPath = defaultKnownHostsPath() }()
+	Prompt = func(prompt string, _ bool) (string, error) {
+		return "", fmt.Errorf("unexpected prompt %q", prompt)
+	}
+	defer func() { Prompt = promptTerminal }()
+
+	// The agent holds a key the server doesn't know
+	l, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	keyring := agent.NewKeyring()
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	keyring.Add(agent.AddedKey{PrivateKey: other})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", l.Addr().String())
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	block, _ := ssh.MarshalPrivateKey(priv, "")
+	identity := filepath.Join(dir, "id_test")
+	os.WriteFile(identity, pem.EncodeToMemory(block), 0600)
+	signer, _ := ssh.NewSignerFromKey(priv)
+	accepted := signer.PublicKey().Marshal()
+
+	hostKey := newHostKey(t)
+	host, port := serveTest(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), accepted) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}, hostKey)
+	addKnownHost(net.JoinHostPort(host, port), hostKey.PublicKey())
+
+	cfg := config.HostConfig{Alias: "t", Host: host, Port: port, User: "alice", IdentityFile: identity}
+	client, err := dialNative(cfg, nil)
+	if err != nil {
+		t.Fatalf("identity not offered after the agent's keys: %v", err)
+	}
+	client.Close()
+}
+
+func TestKnownHostAlgorithms(t *testing.T) {
+	KnownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	defer func() { KnownHostsPath = defaultKnownHostsPath() }()
+
+	addKnownHost("example.com:2222", newHostKey(t).PublicKey())
+	known, err := loadKnownHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if algos := knownHostAlgorithms(known, "example.com:2222"); len(algos) != 1 || algos[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("unexpected algorithms %q", algos)
+	}
+	if algos := knownHostAlgorithms(known, "unknown.example.com:22"); algos != nil {
+		t.Errorf("expected no algorithms for an unknown host, got %q", algos)
+	}
+}
+
+func TestSessionEnv(t *testing.T) {
+	cfg := config.HostConfig{Env: []string{"APP=prod", "LC_ALL=C"}, SendEnv: []string{"LC_*"}}
+	env := sessionEnv(cfg, []string{"LC_ALL=en_US.UTF-8", "LC_TIME=de_DE", "HOME=/root"})
+	if len(env) != 3 || env["APP"] != "prod" || env["LC_ALL"] != "C" || env["LC_TIME"] != "de_DE" {
+		t.Errorf("unexpected env %v", env)
+	}
+}
+
+func TestClientFor(t *testing.T) {
+	t.Setenv(ClientEnv, config.ClientNative)
+	if _, err := exec.LookPath("ssh"); err == nil {
+		if got := ClientFor(config.HostConfig{Client: config.ClientOpenSSH}); got != config.ClientOpenSSH {
+			t.Errorf("host setting should win over %s, got %s", ClientEnv, got)
+		}
+	}
+	if got := ClientFor(config.HostConfig{}); got != config.ClientNative {
+		t.Errorf("expected %s from the environment, got %s", config.ClientNative, got)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if got := ClientFor(config.HostConfig{Client: config.ClientOpenSSH}); got != config.ClientNative {
+		t.Errorf("expected the native fallback without an ssh binary, got %s", got)
+	}
+}
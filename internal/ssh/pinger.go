@@ -1,11 +1,17 @@
 package ssh
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os/exec"
 	"runtime"
+	"ssh-ogm/internal/config"
 	"strings"
+	"syscall"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -17,61 +23,375 @@ const (
 	StatusChecking ServerStatus = iota
 	StatusOnline
 	StatusOffline
+	StatusAuthFailed // Reachable, but the proxy rejected our credentials
+	StatusBlocked    // Not checked, the proxy in front of it is down
+	StatusDegraded   // The host answers, but not with a working SSH server
+	StatusHostKeyMismatch
+	StatusLoginFailed // Reachable, but the deep check could not log in
 )
 
+// String returns the name used in the status cache and exports
+func (s ServerStatus) String() string {
+	switch s {
+	case StatusOnline:
+		return "online"
+	case StatusOffline:
+		return "offline"
+	case StatusAuthFailed:
+		return "auth_failed"
+	case StatusBlocked:
+		return "blocked"
+	case StatusDegraded:
+		return "degraded"
+	case StatusHostKeyMismatch:
+		return "host_key_mismatch"
+	case StatusLoginFailed:
+		return "login_failed"
+	}
+	return "checking"
+}
+
+// Stage is a step of a health check, in the order they run
+type Stage int
+
+const (
+	StageNone Stage = iota
+	StageDNS
+	StageTCP
+	StageBanner
+	StageKEX
+	StageAuth
+)
+
+var stageNames = []string{"none", "DNS", "TCP", "banner", "KEX", "auth"}
+
+func (s Stage) String() string {
+	return stageNames[s]
+}
+
+// StageTiming is how long a completed stage took
+type StageTiming struct {
+	Stage    Stage
+	Duration time.Duration
+}
+
+// ErrorClass names the common reasons a check fails
+type ErrorClass string
+
+const (
+	ClassNXDomain  ErrorClass = "NXDOMAIN"
+	ClassRefused   ErrorClass = "refused"
+	ClassTimeout   ErrorClass = "timeout"
+	ClassNoRoute   ErrorClass = "no route"
+	ClassProxyAuth ErrorClass = "proxy auth"
+	ClassProtocol  ErrorClass = "protocol" // Something answered, but not an SSH server we can talk to
+	ClassHostKey   ErrorClass = "host key"
+	ClassLogin     ErrorClass = "login"
+)
+
+// errHostKeyMismatch is wrapped by the error of checks that found a changed host key
+var errHostKeyMismatch = errors.New("host key mismatch")
+
+// errLoginFailed is wrapped by the error of deep checks that could not log in
+var errLoginFailed = errors.New("login failed")
+
 // ServerHealth holds the status of a server
 type ServerHealth struct {
-	Alias  string
-	Status ServerStatus
-	Error  error
-}
-
-// CheckConnection attempts to check server availability via:
-// 1. SSH Handshake (Gold standard)
-// 2. TCP Connect (Fallback if SSH auth fails fast)
-// 3. ICMP Ping (Fallback if port is closed/filtered)
-func CheckConnection(host, port string) ServerStatus {
-	// 1. Try SSH Handshake
-	// We use "none" auth method. If server is up, it will reject us with "unable to authenticate",
-	// which counts as GREEN (Online).
-	sshConfig := &ssh.ClientConfig{
-		User:            "test", // User doesn't matter for handshake check
-		Auth:            []ssh.AuthMethod{ssh.Password("test")}, 
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // We just want to check reachability
-		Timeout:         4 * time.Second,
+	Alias   string
+	Status  ServerStatus
+	Error   error
+	Class   ErrorClass    // Why the check failed, empty when unknown
+	Route   string        // How the host was reached, "direct" or "via <proxy>"
+	Stage   Stage         // The last stage that completed
+	Failed  Stage         // The stage that failed, StageNone if none did
+	Timings []StageTiming // Latency of each completed stage
+	Checks  []CheckResult // Each of the host's checks, when it has a check key
+
+	// What the server identified as, e.g. "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13",
+	// and the algorithms the key exchange settled on
+	Banner     string
+	Algorithms *Negotiated
+
+	// The host key the server presented, and whether known_hosts agrees
+	KeyType     string
+	Fingerprint string
+	KeyState    HostKeyState
+}
+
+// Latency returns how long stage took, or 0 if it did not complete
+func (h ServerHealth) Latency(stage Stage) time.Duration {
+	for _, t := range h.Timings {
+		if t.Stage == stage {
+			return t.Duration
+		}
 	}
+	return 0
+}
 
-	target := fmt.Sprintf("%s:%s", host, cmdPort(port))
-	conn, err := ssh.Dial("tcp", target, sshConfig)
-	if err == nil {
-		conn.Close()
-		return StatusOnline
+// Handshake returns the SSH handshake round trip: banner, key exchange and
+// the auth exchange. It is 0 unless the check got all the way through.
+func (h ServerHealth) Handshake() time.Duration {
+	if h.Stage != StageAuth {
+		return 0
 	}
+	return h.Latency(StageBanner) + h.Latency(StageKEX) + h.Latency(StageAuth)
+}
 
-	// Analyze SSH error
-	// If the error implies we reached the server but failed auth, it's ONLINE.
-	// Common errors: "ssh: handshake failed", "unable to authenticate"
-	errMsg := err.Error()
-	if strings.Contains(errMsg, "unable to authenticate") || 
-	   strings.Contains(errMsg, "handshake failed") ||
-	   strings.Contains(errMsg, "no common algorithm") {
-		return StatusOnline
+// checkTimeout bounds each stage of a check
+const checkTimeout = 4 * time.Second
+
+// done records that stage completed after d
+func (h *ServerHealth) done(stage Stage, d time.Duration) {
+	h.Stage = stage
+	h.Timings = append(h.Timings, StageTiming{Stage: stage, Duration: d})
+}
+
+// fail stops the check at stage
+func (h *ServerHealth) fail(stage Stage, status ServerStatus, err error) ServerHealth {
+	h.Failed = stage
+	h.Status = status
+	h.Error = err
+	h.Class = classify(err)
+	if h.Class == "" && stage > StageTCP {
+		h.Class = ClassProtocol
 	}
+	return *h
+}
 
-	// 2. Fallback: Simple TCP Dial (in case SSH Dial logic was too strict)
-	timeout := 2 * time.Second
-	tcpConn, err := net.DialTimeout("tcp", target, timeout)
-	if err == nil {
-		tcpConn.Close()
-		return StatusOnline
+// classify maps err to an ErrorClass. SOCKS replies carry the same errno
+// values as a local dial so both are classified alike.
+func classify(err error) ErrorClass {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return ClassNXDomain
+	case errors.Is(err, ErrProxyAuth):
+		return ClassProxyAuth
+	case errors.Is(err, errHostKeyMismatch):
+		return ClassHostKey
+	case errors.Is(err, errLoginFailed):
+		return ClassLogin
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ClassRefused
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ClassNoRoute
+	case errors.Is(err, syscall.ETIMEDOUT), errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
 	}
+	return ""
+}
 
-	// 3. Fallback: ICMP Ping
-	if checkPing(host) {
-		return StatusOnline
+// CheckConnection checks a host directly, stage by stage: resolving its
+// name, connecting to the port, reading the SSH banner, key exchange and
+// authentication. A server that gets as far as asking for credentials is
+// online. One that answers ICMP pings while its port is closed, or whose
+// port is open but doesn't speak SSH, is degraded.
+func CheckConnection(host, port string) ServerHealth {
+	return checkDirect(config.HostConfig{Host: host, Port: port})
+}
+
+// checkDirect is CheckConnection for c, honouring its host key pins and
+// auth_check
+func checkDirect(c config.HostConfig) ServerHealth {
+	host, port := c.Host, c.Port
+	var h ServerHealth
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	cancel()
+	if err != nil {
+		return h.fail(StageDNS, StatusOffline, err)
 	}
+	h.done(StageDNS, time.Since(start))
 
-	return StatusOffline
+	start = time.Now()
+	var conn net.Conn
+	for _, addr := range addrs {
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(addr, cmdPort(port)), checkTimeout)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		status := StatusOffline
+		if checkPing(host) {
+			status = StatusDegraded
+		}
+		return h.fail(StageTCP, status, err)
+	}
+	h.done(StageTCP, time.Since(start))
+
+	return probeSSH(h, conn, net.JoinHostPort(host, cmdPort(port)), c)
+}
+
+// CheckRoute checks c along the route a connection would take: through
+// proxy when c has one, directly otherwise. Behind a proxy names are
+// resolved by the proxy, so the DNS stage is skipped, and there is no ICMP
+// fallback. proxy is nil when c.Proxy is not in proxies.conf.
+func CheckRoute(c config.HostConfig, proxy *config.HostConfig) ServerHealth {
+	if c.Proxy == "" {
+		health := checkDirect(c)
+		health.Alias, health.Route = c.Alias, "direct"
+		return health
+	}
+
+	health := routeHealth(c)
+	if err := missingProxy(c, proxy); err != nil {
+		return health.fail(StageNone, StatusOffline, err)
+	}
+	addr := net.JoinHostPort(c.Host, cmdPort(c.Port))
+	start := time.Now()
+	conn, err := Dial(proxy, addr, checkTimeout)
+	if err != nil {
+		return health.fail(StageTCP, dialStatus(err), err)
+	}
+	health.done(StageTCP, time.Since(start))
+
+	return probeSSH(health, conn, addr, c)
+}
+
+// probeSSH runs the SSH stages of a check of c over conn, which it closes.
+// We offer no credentials, so the server rejecting us completes the auth
+// stage, unless c has auth_check: then we log in as c's user with the keys
+// and passwords available without a terminal, and a rejection fails the
+// check. No session is opened either way. The host key is checked against
+// pins, or known_hosts if there are none, but never recorded.
+func probeSSH(h ServerHealth, conn net.Conn, addr string, c config.HostConfig) ServerHealth {
+	defer conn.Close()
+	pins := c.HostKeys
+	conn.SetDeadline(time.Now().Add(checkTimeout))
+
+	start := time.Now()
+	rec := &kexRecorder{Conn: conn}
+	br := bufio.NewReader(rec)
+	banner, err := readBanner(br)
+	if err != nil {
+		return h.fail(StageBanner, StatusDegraded, fmt.Errorf("no SSH banner: %w", err))
+	}
+	h.done(StageBanner, time.Since(start))
+	h.Banner = strings.TrimRight(banner, "\r\n")
+
+	start = time.Now()
+	var kexDone time.Time
+	known, knownErr := loadKnownHosts()
+	sshConfig := &ssh.ClientConfig{
+		User: "mux-ssh",
+		HostKeyCallback: func(hostname string, _ net.Addr, key ssh.PublicKey) error {
+			kexDone = time.Now()
+			h.KeyType, h.Fingerprint = key.Type(), ssh.FingerprintSHA256(key)
+			switch {
+			case len(pins) > 0 && isPinned(pins, key):
+				h.KeyState = HostKeyPinned
+			case len(pins) > 0:
+				h.KeyState = HostKeyMismatch
+			case knownErr == nil:
+				h.KeyState = checkHostKey(known, hostname, key)
+			}
+			if h.KeyState == HostKeyMismatch {
+				return errHostKeyMismatch
+			}
+			return nil
+		},
+	}
+	var authErr error
+	if c.AuthCheck {
+		var auth []ssh.AuthMethod
+		var closeAgent func()
+		auth, closeAgent, authErr = probeAuthMethods(c)
+		defer closeAgent()
+		if authErr == nil {
+			sshConfig.User, sshConfig.Auth = loginUser(c), auth
+		}
+	}
+	if knownErr == nil && len(pins) == 0 {
+		// Ask for the key type known_hosts has, another type would look changed
+		sshConfig.HostKeyAlgorithms = knownHostAlgorithms(known, addr)
+	}
+	// The SSH library reads the banner itself, so hand it back
+	replay := &bufferedConn{Conn: rec, r: bufio.NewReader(io.MultiReader(strings.NewReader(banner), br))}
+	client, chans, reqs, err := ssh.NewClientConn(replay, addr, sshConfig)
+	if h.KeyState == HostKeyMismatch {
+		source := KnownHostsPath
+		if len(pins) > 0 {
+			source = "the hostkey pins"
+		}
+		return h.fail(StageKEX, StatusHostKeyMismatch, fmt.Errorf("%w: %s %s is not the key %s has for %s",
+			errHostKeyMismatch, h.KeyType, h.Fingerprint, source, addr))
+	}
+	if kexDone.IsZero() {
+		return h.fail(StageKEX, StatusDegraded, err)
+	}
+	h.done(StageKEX, kexDone.Sub(start))
+	h.Algorithms, _ = rec.negotiated()
+
+	switch {
+	case err == nil:
+		// Logged in, or no authentication required at all
+		ssh.NewClient(client, chans, reqs).Close()
+	case !isAuthRejection(err):
+		return h.fail(StageAuth, StatusDegraded, err)
+	case c.AuthCheck && authErr == nil:
+		return h.fail(StageAuth, StatusLoginFailed, fmt.Errorf("%w: %s was rejected: %v", errLoginFailed, sshConfig.User, err))
+	}
+	if authErr != nil {
+		// The server is fine, but we have nothing to log in with
+		return h.fail(StageAuth, StatusLoginFailed, fmt.Errorf("%w: %v", errLoginFailed, authErr))
+	}
+	h.done(StageAuth, time.Since(kexDone))
+	h.Status = StatusOnline
+	return h
+}
+
+// isAuthRejection reports whether err, from the SSH handshake, means the
+// server turned down every method we offered. The SSH library has no error
+// value for this, only the message, so the match is kept here;
+// TestCheckLogin fails if the wording changes.
+func isAuthRejection(err error) bool {
+	return strings.Contains(err.Error(), "ssh: unable to authenticate")
+}
+
+// readBanner returns the server's version line. Servers may send other
+// lines before it.
+func readBanner(r *bufio.Reader) (string, error) {
+	for range 20 {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(line, "SSH-") {
+			return line, nil
+		}
+	}
+	return "", errors.New("too many lines before the SSH banner")
+}
+
+// CheckProxy connects to a proxy and, for SOCKS5, logs in with its
+// credentials so wrong passwords show up before a connection needs them.
+// https proxies must complete a verified TLS handshake.
+func CheckProxy(p config.HostConfig) ServerStatus {
+	conn, err := dialProxy(p, checkTimeout)
+	if err != nil {
+		return StatusOffline
+	}
+	defer conn.Close()
+	if p.Type == "http" || p.Type == "https" {
+		// Credentials are only checked by a CONNECT, which needs a target
+		return StatusOnline
+	}
+	conn.SetDeadline(time.Now().Add(checkTimeout))
+	password, err := Password(p)
+	if err != nil {
+		return StatusAuthFailed
+	}
+	if err := socksAuthenticate(conn, p.User, password); err != nil {
+		if errors.Is(err, ErrProxyAuth) {
+			return StatusAuthFailed
+		}
+		return StatusOffline
+	}
+	return StatusOnline
 }
 
 func cmdPort(p string) string {
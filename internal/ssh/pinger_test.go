@@ -0,0 +1,202 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"ssh-ogm/internal/config"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestCheckConnectionStages(t *testing.T) {
+	host, port, _ := startTestServer(t)
+	health := CheckConnection(host, port)
+	if health.Status != StatusOnline || health.Stage != StageAuth || health.Failed != StageNone {
+		t.Fatalf("got %s at %s (%v)", health.Status, health.Stage, health.Error)
+	}
+	want := []Stage{StageDNS, StageTCP, StageBanner, StageKEX, StageAuth}
+	if len(health.Timings) != len(want) {
+		t.Fatalf("got timings %v", health.Timings)
+	}
+	for i, timing := range health.Timings {
+		if timing.Stage != want[i] {
+			t.Errorf("timing %d is for %s, want %s", i, timing.Stage, want[i])
+		}
+	}
+	if health.Latency(StageTCP) != health.Timings[1].Duration || health.Latency(StageDNS) != health.Timings[0].Duration {
+		t.Errorf("Latency doesn't match the timings %v", health.Timings)
+	}
+	if health.Handshake() <= 0 {
+		t.Errorf("no handshake time in %v", health.Timings)
+	}
+	if health.Banner != "SSH-2.0-Go" {
+		t.Errorf("banner %q", health.Banner)
+	}
+	if a := health.Algorithms; a == nil || a.KeyExchange == "" || a.HostKey != health.KeyType || a.Cipher == "" {
+		t.Errorf("negotiated algorithms %+v", a)
+	}
+}
+
+func TestCheckConnectionHostKey(t *testing.T) {
+	KnownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	defer func() { KnownHostsPath = defaultKnownHostsPath() }()
+	host, port, hostKey := startTestServer(t)
+	addr := net.JoinHostPort(host, port)
+	check := func(want HostKeyState) ServerHealth {
+		t.Helper()
+		health := CheckConnection(host, port)
+		if health.KeyState != want {
+			t.Errorf("key state %d, want %d (%v)", health.KeyState, want, health.Error)
+		}
+		if health.Fingerprint != ssh.FingerprintSHA256(hostKey.PublicKey()) || health.KeyType != ssh.KeyAlgoED25519 {
+			t.Errorf("unexpected key %s %s", health.KeyType, health.Fingerprint)
+		}
+		return health
+	}
+
+	if health := check(HostKeyUnknown); health.Status != StatusOnline {
+		t.Errorf("unknown key: got %s", health.Status)
+	}
+	if _, err := os.Stat(KnownHostsPath); !os.IsNotExist(err) {
+		t.Error("checks must not record host keys")
+	}
+
+	// Hashed entries are recognised too
+	hashed := knownhosts.HashHostname(knownhosts.Normalize(addr))
+	os.WriteFile(KnownHostsPath, []byte(knownhosts.Line([]string{hashed}, hostKey.PublicKey())+"\n"), 0600)
+	if health := check(HostKeyKnown); health.Status != StatusOnline {
+		t.Errorf("known key: got %s", health.Status)
+	}
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, newHostKey(t).PublicKey())
+	os.WriteFile(KnownHostsPath, []byte(fmt.Sprintln(line)), 0600)
+	health := check(HostKeyMismatch)
+	if health.Status != StatusHostKeyMismatch || health.Class != ClassHostKey || health.Failed != StageKEX {
+		t.Errorf("changed key: got %s (%s) at %s", health.Status, health.Class, health.Failed)
+	}
+}
+
+func TestCheckConnectionDegraded(t *testing.T) {
+	// Something listens on the port, but it is not an SSH server
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+			c.Close()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+
+	health := CheckConnection(host, port)
+	if health.Status != StatusDegraded || health.Failed != StageBanner || health.Class != ClassProtocol {
+		t.Errorf("got %s (%s) at %s: %v", health.Status, health.Class, health.Failed, health.Error)
+	}
+}
+
+func TestCheckLogin(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	host, port, _ := startTestServer(t)
+	c := config.HostConfig{Alias: "t", Host: host, Port: port, User: "bob", Password: "secret", AuthCheck: true}
+
+	if health := CheckRoute(c, nil); health.Status != StatusOnline || health.Stage != StageAuth {
+		t.Errorf("right password: got %s at %s (%v)", health.Status, health.Stage, health.Error)
+	}
+
+	c.Password = "guess"
+	health := CheckRoute(c, nil)
+	if health.Status != StatusLoginFailed || health.Failed != StageAuth || health.Class != ClassLogin {
+		t.Errorf("wrong password: got %s (%s) at %s", health.Status, health.Class, health.Failed)
+	}
+	if health.Error == nil || !strings.Contains(health.Error.Error(), "bob was rejected") {
+		t.Errorf("wrong password: error %v", health.Error)
+	}
+	if health.Banner == "" || health.Latency(StageKEX) == 0 {
+		t.Errorf("the stages before auth should have completed: %+v", health)
+	}
+
+	// Without auth_check the same host is merely reachable
+	c.AuthCheck = false
+	if health := CheckRoute(c, nil); health.Status != StatusOnline {
+		t.Errorf("shallow check: got %s (%v)", health.Status, health.Error)
+	}
+
+	// The server rejects the key, then the first password attempt
+	os.MkdirAll(filepath.Join(home, ".ssh"), 0700)
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	block, _ := ssh.MarshalPrivateKey(priv, "")
+	os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519"), pem.EncodeToMemory(block), 0600)
+	var keys, passwords atomic.Int32
+	fussyHost, fussyPort := serveTest(t, &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			keys.Add(1)
+			return nil, ssh.ErrNoAuth
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if passwords.Add(1) == 1 || string(pass) != "secret" {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}, newHostKey(t))
+	fussy := config.HostConfig{Alias: "t", Host: fussyHost, Port: fussyPort, User: "bob", Password: "secret", AuthCheck: true}
+	if health := CheckRoute(fussy, nil); health.Status != StatusOnline || keys.Load() == 0 || passwords.Load() != 2 {
+		t.Errorf("key then password: got %s (%v) after %d keys and %d passwords", health.Status, health.Error, keys.Load(), passwords.Load())
+	}
+
+	// Credentials that can't be loaded fail the login too
+	if runtime.GOOS == "windows" {
+		return // identity_command uses sh
+	}
+	c = config.HostConfig{Alias: "t", Host: host, Port: port, User: "bob", IdentityCommand: "exit 1", AuthCheck: true}
+	if health := CheckRoute(c, nil); health.Status != StatusLoginFailed || !strings.Contains(health.Error.Error(), "identity_command") {
+		t.Errorf("broken identity_command: got %s (%v)", health.Status, health.Error)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{&net.DNSError{Err: "no such host", Name: "nope.example", IsNotFound: true}, ClassNXDomain},
+		{&net.DNSError{Err: "i/o timeout", Name: "slow.example", IsTimeout: true}, ClassTimeout},
+		{&net.OpError{Op: "dial", Err: &timeoutError{}}, ClassTimeout},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.err); got != tt.want {
+			t.Errorf("classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+
+	// A closed local port is refused
+	_, err := net.Dial("tcp", "127.0.0.1:1")
+	if got := classify(err); got != ClassRefused {
+		t.Errorf("classify(%v) = %q, want refused", err, got)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
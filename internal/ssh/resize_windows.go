@@ -0,0 +1,32 @@
+package ssh
+
+import (
+	"time"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/crypto/ssh"
+)
+
+// watchResize forwards terminal size changes to the session until stop is
+// called. Windows has no SIGWINCH, so the size is polled.
+func watchResize(session *ssh.Session, fd uintptr) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		lastWidth, lastHeight, _ := term.GetSize(fd)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				width, height, err := term.GetSize(fd)
+				if err == nil && (width != lastWidth || height != lastHeight) {
+					lastWidth, lastHeight = width, height
+					session.WindowChange(height, width)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -6,63 +6,32 @@ import (
 	"os/exec"
 	"runtime"
 	"ssh-ogm/internal/config"
+	"strings"
 )
 
 // Connect connects to the host defined in the config, optionally via a proxy
 func Connect(cfg config.HostConfig, proxyCfg *config.HostConfig) error {
-	// Construct arguments
-	args := []string{}
-	// Port
-	if cfg.Port != "" {
-		args = append(args, "-p", cfg.Port)
-	}
-	// Identity
-	if cfg.IdentityFile != "" {
-		args = append(args, "-i", cfg.IdentityFile)
-	}
-
-	// Proxy Command Logic
-	if proxyCfg != nil {
-		// Detect nc/netcat
-		// We assumes 'nc' is available on mac/linux as discussed.
-		// Command: nc -x proxyHost:proxyPort host port (for SOCKS5)
-		//          nc -X connect -x proxyHost:proxyPort host port (for HTTP/HTTPS CONNECT if suppported)
-		// macOS nc supports -X (proto) -x (proxy).
-		// Linux nc (openbsd) supports same. Traditional netcat might not.
-		// User mentioned "type(http/socks5)".
-		
-		// Construct ProxyCommand string
-		var proxyCmd string
-		proxyHost := proxyCfg.Host
-		proxyPort := proxyCfg.Port
-		
-		switch proxyCfg.Type {
-		case "socks5":
-			// nc -x proxy:port %h %p
-			proxyCmd = fmt.Sprintf("nc -x %s:%s %%h %%p", proxyHost, proxyPort)
-		case "http":
-			// nc -X connect -x proxy:port %h %p
-			proxyCmd = fmt.Sprintf("nc -X connect -x %s:%s %%h %%p", proxyHost, proxyPort)
-		default:
-			// Default to socks5 if unspecified or use safe default?
-			// Let's assume socks5 as it's common for SSH.
-			proxyCmd = fmt.Sprintf("nc -x %s:%s %%h %%p", proxyHost, proxyPort)
-		}
-
-		args = append(args, "-o", fmt.Sprintf("ProxyCommand=%s", proxyCmd))
+	if ClientFor(cfg) == config.ClientNative {
+		return connectNative(cfg, proxyCfg)
 	}
 
-	// User@Host
-	target := cfg.Host
-	if cfg.User != "" {
-		target = fmt.Sprintf("%s@%s", cfg.User, cfg.Host)
+	args, tempFiles, err := sshArgs(cfg, proxyCfg)
+	if err != nil {
+		return err
 	}
-	args = append(args, target)
 
 	// Try to spawn in a new window based on OS
 	var cmd *exec.Cmd
-	
-	switch runtime.GOOS {
+
+	goos := runtime.GOOS
+	if tempFiles {
+		// A key fetched by identity_command, the known_hosts of pinned keys
+		// or a proxy password is deleted once we return, so ssh has to run
+		// inline rather than in a detached terminal window.
+		goos = "inline"
+	}
+
+	switch goos {
 	case "darwin":
         // Fallback to inline for now to ensure reliability, as 'open' is complex with args.
         cmd = exec.Command("ssh", args...)
@@ -105,3 +74,147 @@ func Connect(cfg config.HostConfig, proxyCfg *config.HostConfig) error {
 
 	return cmd.Run()
 }
+
+// sshArgs returns the arguments of the ssh command line for cfg, through
+// proxyCfg when it is not nil. tempFiles reports whether they refer to files
+// that only live until Cleanup.
+func sshArgs(cfg config.HostConfig, proxyCfg *config.HostConfig) (args []string, tempFiles bool, err error) {
+	// Construct arguments
+	args = []string{}
+	tempFiles = cfg.IdentityCommand != "" || len(cfg.HostKeys) > 0
+	// Port
+	if cfg.Port != "" {
+		args = append(args, "-p", cfg.Port)
+	}
+	// Identity
+	identity, err := IdentityFile(cfg)
+	if err != nil {
+		return nil, false, err
+	}
+	if identity != "" {
+		args = append(args, "-i", identity)
+	}
+
+	// Environment
+	if len(cfg.Env) > 0 {
+		// OpenSSH only honours the first SetEnv option, so send them all at once
+		var vars []string
+		for _, kv := range cfg.Env {
+			if strings.ContainsAny(kv, " \t\"'\\") {
+				kv = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(kv) + `"`
+			}
+			vars = append(vars, kv)
+		}
+		args = append(args, "-o", "SetEnv="+strings.Join(vars, " "))
+	}
+	for _, pattern := range cfg.SendEnv {
+		args = append(args, "-o", "SendEnv="+pattern)
+	}
+
+	// Pinned host keys replace known_hosts entirely
+	if len(cfg.HostKeys) > 0 {
+		knownHosts, err := pinnedKnownHosts(cfg, proxyCfg)
+		if err != nil {
+			return nil, false, err
+		}
+		args = append(args,
+			"-o", fmt.Sprintf(`UserKnownHostsFile="%s"`, knownHosts),
+			"-o", "GlobalKnownHostsFile=none",
+			"-o", "StrictHostKeyChecking=yes")
+	}
+
+	// Proxy Command Logic
+	if proxyCfg != nil {
+		proxyCmd, passwordFile, err := proxyCommand(*proxyCfg)
+		if err != nil {
+			return nil, false, err
+		}
+		tempFiles = tempFiles || passwordFile
+		args = append(args, "-o", fmt.Sprintf("ProxyCommand=%s", proxyCmd))
+	}
+
+	// User@Host
+	target := cfg.Host
+	if cfg.User != "" {
+		target = fmt.Sprintf("%s@%s", cfg.User, cfg.Host)
+	}
+	remote := RemoteCommand(cfg)
+	if remote != "" {
+		// Commands like tmux or sudo -i need a TTY to stay interactive
+		args = append(args, "-t")
+	}
+	args = append(args, target)
+	if remote != "" {
+		args = append(args, remote)
+	}
+	return args, tempFiles, nil
+}
+
+// proxyCommand returns the ProxyCommand for p. Every proxy type goes
+// through our own proxy-connect helper so credentials and TLS work without a
+// capable nc. p's settings are passed along, so the helper doesn't load
+// every layer again for each connection. The password is handed over in a
+// private file rather than the environment, which ssh may forward to the
+// server with SendEnv; passwordFile reports whether one was written.
+func proxyCommand(p config.HostConfig) (command string, passwordFile bool, err error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", false, err
+	}
+	quote := func(s string) string { return `"` + s + `"` }
+	if runtime.GOOS != "windows" {
+		// ssh runs ProxyCommand through the user's shell
+		quote = shellQuote
+	}
+
+	line := []string{quote(exe), "proxy-connect"}
+	for _, flag := range []struct{ name, value string }{
+		{"-host", p.Host}, {"-port", p.Port}, {"-type", p.Type}, {"-user", p.User}, {"-ca-bundle", p.CABundle},
+	} {
+		if flag.value != "" {
+			// ssh expands %-tokens in ProxyCommand
+			line = append(line, flag.name, quote(strings.ReplaceAll(flag.value, "%", "%%")))
+		}
+	}
+	if p.User != "" {
+		// Resolved here, where the vault can still prompt on the terminal
+		password, err := Password(p)
+		if err != nil {
+			return "", false, err
+		}
+		path, err := writeSecretFile("mux-ssh-proxy-", password)
+		if err != nil {
+			return "", false, err
+		}
+		line = append(line, "-password-file", quote(strings.ReplaceAll(path, "%", "%%")))
+		passwordFile = true
+	}
+	line = append(line, quote(strings.ReplaceAll(p.Alias, "%", "%%")), "%h", "%p")
+	return strings.Join(line, " "), passwordFile, nil
+}
+
+// RemoteCommand returns the command line to run on the host for cfg's
+// command and cwd, or "" for a plain login shell.
+func RemoteCommand(cfg config.HostConfig) string {
+	if cfg.Cwd == "" {
+		return cfg.Command
+	}
+
+	dir := shellQuote(cfg.Cwd)
+	if rest, ok := strings.CutPrefix(cfg.Cwd, "~/"); ok {
+		// Keep the tilde outside the quotes so the remote shell expands it
+		dir = "~/" + shellQuote(rest)
+	} else if cfg.Cwd == "~" {
+		dir = "~"
+	}
+
+	if cfg.Command == "" {
+		return fmt.Sprintf(`cd %s && exec "$SHELL" -l`, dir)
+	}
+	return fmt.Sprintf("cd %s && %s", dir, cfg.Command)
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
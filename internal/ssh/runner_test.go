@@ -0,0 +1,127 @@
+package ssh
+
+import (
+	"os"
+	"runtime"
+	"slices"
+	"ssh-ogm/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestSSHArgs(t *testing.T) {
+	cfg := config.HostConfig{
+		Alias:   "web",
+		Host:    "10.0.0.1",
+		User:    "deploy",
+		Port:    "2222",
+		Env:     []string{"APP=prod", `GREETING=hello "world"`, `PATH_WIN=C:\bin`},
+		SendEnv: []string{"LANG", "LC_*"},
+	}
+	args, tempFiles, err := sshArgs(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"-p", "2222",
+		"-o", `SetEnv=APP=prod "GREETING=hello \"world\"" "PATH_WIN=C:\\bin"`,
+		"-o", "SendEnv=LANG",
+		"-o", "SendEnv=LC_*",
+		"deploy@10.0.0.1",
+	}
+	if !slices.Equal(args, want) {
+		t.Errorf("args\n got %q\nwant %q", args, want)
+	}
+	if tempFiles {
+		t.Error("no temporary files were needed")
+	}
+
+	// A remote command needs a TTY and comes last
+	cfg = config.HostConfig{Host: "10.0.0.1", Command: "htop"}
+	if args, _, _ = sshArgs(cfg, nil); !slices.Equal(args, []string{"-t", "10.0.0.1", "htop"}) {
+		t.Errorf("command args %q", args)
+	}
+}
+
+func TestSSHArgsProxyPassword(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("checks unix permissions")
+	}
+	defer Cleanup()
+	environ := os.Environ()
+	proxy := config.HostConfig{Alias: "corp", Host: "proxy.local", Port: "1080", Type: "socks5", User: "alice", Password: "s3cret"}
+	cfg := config.HostConfig{Host: "10.0.0.1", SendEnv: []string{"*"}, Proxy: "corp"}
+
+	args, tempFiles, err := sshArgs(cfg, &proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tempFiles {
+		t.Error("the password file must keep ssh inline")
+	}
+	// With send_env: * ssh forwards everything, so the password stays out of the environment
+	if !slices.Equal(os.Environ(), environ) || strings.Contains(strings.Join(args, " "), "s3cret") {
+		t.Fatalf("password leaked into env or args: %q", args)
+	}
+	i := slices.IndexFunc(args, func(a string) bool { return strings.HasPrefix(a, "ProxyCommand=") })
+	if i < 0 {
+		t.Fatalf("no ProxyCommand in %q", args)
+	}
+	fields := strings.Fields(args[i])
+	want := []string{"proxy-connect", "-host", "'proxy.local'", "-port", "'1080'", "-type", "'socks5'", "-user", "'alice'", "-password-file"}
+	if !slices.Equal(fields[1:len(want)+1], want) || !slices.Equal(fields[len(fields)-3:], []string{"'corp'", "%h", "%p"}) {
+		t.Fatalf("ProxyCommand %q", args[i])
+	}
+	path := strings.Trim(fields[len(want)+1], "'")
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("password file %s: %v, %v", path, info, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "s3cret" {
+		t.Errorf("password file holds %q", data)
+	}
+
+	Cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("password file not removed by Cleanup")
+	}
+}
+
+func TestRemoteCommand(t *testing.T) {
+	tests := []struct {
+		cwd, command, want string
+	}{
+		{"", "", ""},
+		{"", "htop", "htop"},
+		{"/srv/app", "", `cd '/srv/app' && exec "$SHELL" -l`},
+		{"/srv/app", "make test", "cd '/srv/app' && make test"},
+		// The tilde stays unquoted so the remote shell expands it
+		{"~", "", `cd ~ && exec "$SHELL" -l`},
+		{"~/src/my app", "ls", "cd ~/'src/my app' && ls"},
+		{"~alice/src", "", `cd '~alice/src' && exec "$SHELL" -l`},
+		{"/srv/it's here", "", `cd '/srv/it'\''s here' && exec "$SHELL" -l`},
+		{"~/it's", "", `cd ~/'it'\''s' && exec "$SHELL" -l`},
+	}
+	for _, tt := range tests {
+		got := RemoteCommand(config.HostConfig{Cwd: tt.cwd, Command: tt.command})
+		if got != tt.want {
+			t.Errorf("RemoteCommand(cwd %q, command %q) = %s, want %s", tt.cwd, tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := map[string]string{
+		"":           "''",
+		"plain":      "'plain'",
+		"two words":  "'two words'",
+		"it's":       `'it'\''s'`,
+		"''":         `''\'''\'''`,
+		"$HOME `id`": "'$HOME `id`'",
+	}
+	for in, want := range tests {
+		if got := shellQuote(in); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
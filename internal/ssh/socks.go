@@ -0,0 +1,157 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// ErrProxyAuth is wrapped by every error caused by rejected proxy credentials
+var ErrProxyAuth = errors.New("proxy authentication failed")
+
+// SOCKS5 constants from RFC 1928 and RFC 1929
+const (
+	socksVersion       = 5
+	socksNoAuth        = 0x00
+	socksUserPass      = 0x02
+	socksNoAcceptable  = 0xff
+	socksUserPassVer   = 1
+	socksCmdConnect    = 1
+	socksAtypIPv4      = 1
+	socksAtypDomain    = 3
+	socksAtypIPv6      = 4
+	socksReplySucceded = 0
+)
+
+// socksReplies describes failed CONNECT replies. Failures a local dial can
+// have too use the same errno so health checks classify them alike.
+var socksReplies = map[byte]error{
+	1: errors.New("general SOCKS server failure"),
+	2: errors.New("connection not allowed by ruleset"),
+	3: syscall.ENETUNREACH,
+	4: syscall.EHOSTUNREACH,
+	5: syscall.ECONNREFUSED,
+	6: syscall.ETIMEDOUT, // TTL expired
+	7: errors.New("command not supported"),
+	8: errors.New("address type not supported"),
+}
+
+// socksAuthenticate negotiates a method on conn and logs in with user and
+// password when the proxy asks for them.
+func socksAuthenticate(conn io.ReadWriter, user, password string) error {
+	methods := []byte{socksNoAuth}
+	if user != "" {
+		methods = append(methods, socksUserPass)
+	}
+	greeting := append([]byte{socksVersion, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("reading SOCKS greeting: %w", err)
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("not a SOCKS5 proxy (version %d)", reply[0])
+	}
+
+	switch reply[1] {
+	case socksNoAuth:
+		return nil
+	case socksUserPass:
+		if user == "" {
+			return fmt.Errorf("%w: proxy requires a username and password", ErrProxyAuth)
+		}
+		if len(user) > 255 || len(password) > 255 {
+			return fmt.Errorf("%w: username and password must be at most 255 bytes", ErrProxyAuth)
+		}
+		req := []byte{socksUserPassVer, byte(len(user))}
+		req = append(req, user...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return fmt.Errorf("reading SOCKS auth reply: %w", err)
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("%w: username or password rejected", ErrProxyAuth)
+		}
+		return nil
+	case socksNoAcceptable:
+		if user == "" {
+			return fmt.Errorf("%w: proxy requires authentication", ErrProxyAuth)
+		}
+		return fmt.Errorf("%w: proxy accepts none of the offered methods", ErrProxyAuth)
+	}
+	return fmt.Errorf("proxy chose unsupported auth method %d", reply[1])
+}
+
+// socksConnect asks the proxy to connect to addr. Hostnames are sent as is
+// so they are resolved by the proxy, which often sees a different DNS.
+func socksConnect(conn io.ReadWriter, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %s", portStr)
+	}
+
+	req := []byte{socksVersion, socksCmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("hostname too long: %s", host)
+		}
+		req = append(req, socksAtypDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socksAtypIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, socksAtypIPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return fmt.Errorf("reading SOCKS reply: %w", err)
+	}
+	if head[1] != socksReplySucceded {
+		reason, ok := socksReplies[head[1]]
+		if !ok {
+			reason = fmt.Errorf("error code %d", head[1])
+		}
+		return fmt.Errorf("proxy could not connect to %s: %w", addr, reason)
+	}
+
+	// Skip the bound address, it is of no use to us
+	var skip int
+	switch head[3] {
+	case socksAtypIPv4:
+		skip = net.IPv4len
+	case socksAtypIPv6:
+		skip = net.IPv6len
+	case socksAtypDomain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return err
+		}
+		skip = int(n[0])
+	default:
+		return fmt.Errorf("unknown address type %d in SOCKS reply", head[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
@@ -0,0 +1,217 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"ssh-ogm/internal/config"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startSOCKSServer runs a minimal SOCKS5 proxy requiring alice/secret.
+// Requested addresses are sent on the returned channel.
+func startSOCKSServer(t *testing.T) (config.HostConfig, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	requested := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS(conn, requested)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return config.HostConfig{Alias: "corp", Host: host, Port: port, Type: "socks5", User: "alice", Password: "secret"}, requested
+}
+
+func serveSOCKS(conn net.Conn, requested chan<- string) {
+	defer conn.Close()
+	head := make([]byte, 2)
+	io.ReadFull(conn, head)
+	methods := make([]byte, head[1])
+	io.ReadFull(conn, methods)
+	if !strings.Contains(string(methods), "\x02") {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, 2})
+
+	io.ReadFull(conn, head)
+	user := make([]byte, head[1])
+	io.ReadFull(conn, user)
+	io.ReadFull(conn, head[:1])
+	pass := make([]byte, head[0])
+	io.ReadFull(conn, pass)
+	if string(user) != "alice" || string(pass) != "secret" {
+		conn.Write([]byte{1, 1})
+		return
+	}
+	conn.Write([]byte{1, 0})
+
+	req := make([]byte, 4)
+	io.ReadFull(conn, req)
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		io.ReadFull(conn, head[:1])
+		name := make([]byte, head[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	}
+	portBytes := make([]byte, 2)
+	io.ReadFull(conn, portBytes)
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(portBytes))))
+	requested <- addr
+
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestSOCKSDial(t *testing.T) {
+	proxy, requested := startSOCKSServer(t)
+
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		c, err := echo.Accept()
+		if err == nil {
+			io.Copy(c, c)
+			c.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(echo.Addr().String())
+
+	// Hostnames are passed to the proxy unresolved
+	conn, err := Dial(&proxy, net.JoinHostPort("localhost", port), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-requested; got != "localhost:"+port {
+		t.Errorf("proxy was asked for %s", got)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	io.ReadFull(conn, buf)
+	conn.Close()
+	if string(buf) != "ping" {
+		t.Errorf("tunnel returned %q", buf)
+	}
+
+	// Refused targets report the SOCKS reply
+	_, err = Dial(&proxy, "127.0.0.1:1", time.Second)
+	if err == nil || !strings.Contains(err.Error(), "connection refused") || errors.Is(err, ErrProxyAuth) {
+		t.Errorf("expected a refused error, got %v", err)
+	}
+}
+
+func TestSOCKSAuthErrors(t *testing.T) {
+	proxy, _ := startSOCKSServer(t)
+
+	wrong := proxy
+	wrong.Password = "guess"
+	if _, err := Dial(&wrong, "example.com:22", time.Second); !errors.Is(err, ErrProxyAuth) {
+		t.Errorf("wrong password: expected ErrProxyAuth, got %v", err)
+	}
+	if status := CheckProxy(wrong); status != StatusAuthFailed {
+		t.Errorf("CheckProxy with a wrong password = %s", status)
+	}
+
+	anonymous := proxy
+	anonymous.User, anonymous.Password = "", ""
+	_, err := Dial(&anonymous, "example.com:22", time.Second)
+	if !errors.Is(err, ErrProxyAuth) || !strings.Contains(err.Error(), "requires authentication") {
+		t.Errorf("missing credentials: got %v", err)
+	}
+
+	if status := CheckProxy(proxy); status != StatusOnline {
+		t.Errorf("CheckProxy with valid credentials = %s", status)
+	}
+}
+
+func TestNativeThroughSOCKS(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	KnownHostsPath = t.TempDir() + "/known_hosts"
+	defer func() { KnownHostsPath = defaultKnownHostsPath() }()
+	Prompt = func(prompt string, echo bool) (string, error) {
+		if echo {
+			return "yes", nil
+		}
+		return "secret", nil
+	}
+	defer func() { Prompt = promptTerminal }()
+
+	proxy, requested := startSOCKSServer(t)
+	host, port, _ := startTestServer(t)
+	client, err := dialNative(config.HostConfig{Alias: "t", Host: host, Port: port, User: "bob"}, &proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if got := <-requested; got != net.JoinHostPort(host, port) {
+		t.Errorf("proxy was asked for %s", got)
+	}
+}
+
+func TestCheckRoute(t *testing.T) {
+	proxy, requested := startSOCKSServer(t)
+	host, port, _ := startTestServer(t)
+	target := config.HostConfig{Alias: "web", Host: host, Port: port, Proxy: "corp"}
+
+	health := CheckRoute(target, &proxy)
+	if health.Status != StatusOnline || health.Route != "via corp" {
+		t.Errorf("through the proxy: got %s %q (%v)", health.Status, health.Route, health.Error)
+	}
+	if got := <-requested; got != net.JoinHostPort(host, port) {
+		t.Errorf("proxy was asked for %s", got)
+	}
+	// The proxy resolves names, so there is no DNS stage
+	if len(health.Timings) != 4 || health.Timings[0].Stage != StageTCP {
+		t.Errorf("unexpected stages %v", health.Timings)
+	}
+
+	wrong := proxy
+	wrong.Password = "guess"
+	if health := CheckRoute(target, &wrong); health.Status != StatusAuthFailed || health.Class != ClassProxyAuth {
+		t.Errorf("wrong proxy password: got %s (%s)", health.Status, health.Class)
+	}
+	if health := CheckRoute(target, nil); health.Status != StatusOffline || health.Error == nil {
+		t.Errorf("missing proxy: got %s (%v)", health.Status, health.Error)
+	}
+
+	// The proxy's refusal is classified like a local one
+	closed := target
+	closed.Host = "127.0.0.1"
+	closed.Port = "1"
+	health = CheckRoute(closed, &proxy)
+	if health.Status != StatusOffline || health.Class != ClassRefused || health.Failed != StageTCP {
+		t.Errorf("refused through the proxy: got %s (%s) at %s", health.Status, health.Class, health.Failed)
+	}
+}
@@ -1,9 +1,12 @@
 package tui
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 	"ssh-ogm/internal/config"
 	"ssh-ogm/internal/ssh"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -25,21 +28,53 @@ type DashboardModel struct {
 	
 	ServerStatuses   map[string]ssh.ServerStatus
 	ProxyStatuses    map[string]ssh.ServerStatus
+	checked          map[hostKey]time.Time // When each finished check came back
+	health           map[string]ssh.ServerHealth // Full result of each server's last check
 	
 	Cursor     int
 	Results    map[string]ssh.ServerStatus // Temporary holding for batch updates? No, direct map update is fine.
 
 	ActiveView ViewState
 	Selected   *config.HostConfig
+	Plain      bool // Connect without the host's command/cwd
 	Quitting   bool
 	WindowSize tea.WindowSizeMsg
 
+	ShowDetails   bool // Detail pane for the host under the cursor
+	SortByLatency bool // Fastest servers first instead of inventory order
+
+	// A host waiting for 'y': to connect past a changed key, or to forget its key
+	confirmAlias  string
+	confirmForget bool
+
+	Findings []config.Finding // From the security linter
+
 	// For feedback
-	Message string
+	Message  string
+	Warnings []string // Inventory sources that failed to load
+
+	// Inventory commands whose cached output is shown until they finish running
+	StaleSources []string
 }
 
 type PingResultMsg ssh.ServerHealth
 
+// proxyResultMsg is the result of a proxy's check. Proxies get their own
+// message since a server may share a proxy's alias.
+type proxyResultMsg struct {
+	alias  string
+	status ssh.ServerStatus
+}
+
+// hostKey identifies a server, or a proxy, by alias
+type hostKey struct {
+	alias string
+	proxy bool
+}
+
+// openLinkResultMsg reports a failure to open a host's link
+type openLinkResultMsg struct{ err error }
+
 // NewDashboardModel initializes the dashboard with servers and proxies
 func NewDashboardModel(configs, proxies []config.HostConfig, mgr *config.Manager) DashboardModel {
 	sStatuses := make(map[string]ssh.ServerStatus)
@@ -52,47 +87,176 @@ func NewDashboardModel(configs, proxies []config.HostConfig, mgr *config.Manager
 		pStatuses[p.Alias] = ssh.StatusChecking
 	}
 
+	var findings []config.Finding
+	if mgr != nil {
+		findings = mgr.Lint(configs, proxies)
+	}
+
 	return DashboardModel{
 		ConfigManager:  mgr,
+		Findings:       findings,
 		Configs:        configs,
 		Proxies:        proxies,
 		ServerStatuses: sStatuses,
 		ProxyStatuses:  pStatuses,
+		checked:        make(map[hostKey]time.Time),
+		health:         make(map[string]ssh.ServerHealth),
 		Cursor:         0,
 		ActiveView:     ViewServers,
 	}
 }
 
-// checkServerCmd creates a command to check a single host
-func checkHostCmd(c config.HostConfig) tea.Cmd {
+// checkHostCmd creates a command to run the checks of a single host
+func (m DashboardModel) checkHostCmd(c config.HostConfig) tea.Cmd {
+	var proxy *config.HostConfig
+	if p := m.findProxy(c.Proxy); p != nil {
+		cp := *p // The check runs in the background, away from the model
+		proxy = &cp
+	}
 	return func() tea.Msg {
-		status := ssh.CheckConnection(c.Host, c.Port)
-		return PingResultMsg{
-			Alias:  c.Alias,
-			Status: status,
-		}
+		return PingResultMsg(ssh.CheckHost(c, proxy))
 	}
 }
 
-// checkBatch triggers checks for a list of configs
-func checkBatch(configs []config.HostConfig) tea.Cmd {
+// checkBatch triggers checks for a list of configs. Servers behind a proxy
+// depend on it: they wait for the proxy's own check, and are marked blocked
+// instead of checked while it is down.
+func (m DashboardModel) checkBatch(configs []config.HostConfig) tea.Cmd {
 	var cmds []tea.Cmd
 	for _, c := range configs {
-		cmds = append(cmds, checkHostCmd(c))
+		if m.findProxy(c.Proxy) != nil {
+			switch m.ProxyStatuses[c.Proxy] {
+			case ssh.StatusChecking:
+				// Checked once the proxy's result arrives
+				m.ServerStatuses[c.Alias] = ssh.StatusChecking
+				continue
+			case ssh.StatusOffline, ssh.StatusAuthFailed:
+				m.ServerStatuses[c.Alias] = ssh.StatusBlocked
+				m.health[c.Alias] = ssh.ServerHealth{Alias: c.Alias, Status: ssh.StatusBlocked, Route: "via " + c.Proxy}
+				m.checked[hostKey{alias: c.Alias}] = time.Now()
+				continue
+			}
+		}
+		cmds = append(cmds, m.checkHostCmd(c))
+	}
+	return tea.Batch(cmds...)
+}
+
+// servers returns the servers in display order
+func (m DashboardModel) servers() []config.HostConfig {
+	if !m.SortByLatency {
+		return m.Configs
+	}
+	sorted := slices.Clone(m.Configs)
+	// Servers without a measurement keep their order at the end
+	slices.SortStableFunc(sorted, func(a, b config.HostConfig) int {
+		la, lb := m.latency(a.Alias), m.latency(b.Alias)
+		switch {
+		case la == lb:
+			return 0
+		case la == 0:
+			return 1
+		case lb == 0:
+			return -1
+		}
+		return cmp.Compare(la, lb)
+	})
+	return sorted
+}
+
+// latency returns the TCP connect time of alias's last check, or 0 if it
+// did not get that far
+func (m DashboardModel) latency(alias string) time.Duration {
+	return m.health[alias].Latency(ssh.StageTCP)
+}
+
+// Thresholds of the latency column
+const (
+	fastLatency = 50 * time.Millisecond
+	slowLatency = 200 * time.Millisecond
+)
+
+// renderLatency formats the TCP connect time of a server for its row
+func (m DashboardModel) renderLatency(alias string) string {
+	style := lipgloss.NewStyle().Width(6).Align(lipgloss.Right)
+	d := m.latency(alias)
+	switch {
+	case d == 0:
+		return style.Foreground(lipgloss.Color("240")).Render("-")
+	case d < fastLatency:
+		style = style.Foreground(lipgloss.Color("46")) // Green
+	case d < slowLatency:
+		style = style.Foreground(lipgloss.Color("220")) // Yellow
+	default:
+		style = style.Foreground(lipgloss.Color("196")) // Red
+	}
+	if d < time.Second {
+		return style.Render(fmt.Sprintf("%dms", d.Milliseconds()))
+	}
+	return style.Render(fmt.Sprintf("%.1fs", d.Seconds()))
+}
+
+// selectedAlias returns the alias under the cursor, or ""
+func (m DashboardModel) selectedAlias() string {
+	if c := m.selectedHost(); c != nil {
+		return c.Alias
+	}
+	return ""
+}
+
+// moveCursorTo puts the cursor on alias in the active view, if it is there
+func (m *DashboardModel) moveCursorTo(alias string) {
+	for i, c := range m.currentList() {
+		if c.Alias == alias {
+			m.Cursor = i
+			return
+		}
+	}
+}
+
+// behind returns the servers that connect through proxy
+func (m DashboardModel) behind(proxy string) []config.HostConfig {
+	var deps []config.HostConfig
+	for _, c := range m.Configs {
+		if c.Proxy == proxy {
+			deps = append(deps, c)
+		}
+	}
+	return deps
+}
+
+// checkProxies triggers checks for proxies, including their credentials
+func checkProxies(proxies []config.HostConfig) tea.Cmd {
+	var cmds []tea.Cmd
+	for _, p := range proxies {
+		cmds = append(cmds, func() tea.Msg {
+			return proxyResultMsg{alias: p.Alias, status: ssh.CheckProxy(p)}
+		})
 	}
 	return tea.Batch(cmds...)
 }
 
 func (m DashboardModel) Init() tea.Cmd {
-	return tea.Batch(
-		checkBatch(m.Configs),
-		checkBatch(m.Proxies),
-	)
+	cmds := []tea.Cmd{
+		m.checkBatch(m.Configs),
+		checkProxies(m.Proxies),
+	}
+	if len(m.StaleSources) > 0 && m.ConfigManager != nil {
+		cmds = append(cmds, reloadInventoryCmd(m.ConfigManager, m.StaleSources))
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m DashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		// Any key but 'y' cancels a pending confirmation
+		confirm, forget := m.confirmAlias, m.confirmForget
+		if confirm != "" {
+			m.confirmAlias, m.confirmForget = "", false
+			m.Message = ""
+		}
+
 		switch msg.String() {
 		case "q", "ctrl+c":
 			m.Quitting = true
@@ -122,9 +286,17 @@ func (m DashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.Cursor = 0
 			m.Message = ""
 
-		case "enter":
+		case "enter", "p":
 			if m.ActiveView == ViewServers && len(m.Configs) > 0 {
-				selected := m.Configs[m.Cursor]
+				selected := m.servers()[m.Cursor]
+				m.Plain = msg.String() == "p"
+				if m.ServerStatuses[selected.Alias] == ssh.StatusHostKeyMismatch {
+					// The user has to acknowledge the warning first
+					m.confirmAlias = selected.Alias
+					m.Message = fmt.Sprintf("HOST KEY MISMATCH for %s: %s. Someone may be impersonating the server. Press y to connect anyway.",
+						selected.Alias, m.health[selected.Alias].Error)
+					break
+				}
 				m.Selected = &selected
 				return m, tea.Quit
 			}
@@ -136,18 +308,86 @@ func (m DashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Proxy page: "List of all proxies... and their status".
 			// Doesn't explicitly say "Connect to proxy".
 			
+		case "y":
+			if confirm == "" {
+				break
+			}
+			for _, c := range m.Configs {
+				if c.Alias != confirm {
+					continue
+				}
+				if !forget {
+					m.Selected = &c
+					return m, tea.Quit
+				}
+				removed, err := ssh.ForgetHostKey(c)
+				if err != nil {
+					m.Message = fmt.Sprintf("Error forgetting host key: %v", err)
+					break
+				}
+				m.Message = fmt.Sprintf("Removed %d known_hosts line(s) for %s.", removed, c.Alias)
+				m.ServerStatuses[c.Alias] = ssh.StatusChecking
+				return m, m.checkBatch([]config.HostConfig{c})
+			}
+
+		case "f":
+			if m.ActiveView != ViewServers || len(m.Configs) == 0 {
+				break
+			}
+			c := m.servers()[m.Cursor]
+			if len(c.HostKeys) > 0 {
+				m.Message = fmt.Sprintf("%s uses pinned host keys, known_hosts is not used. Run 'mux-ssh pin %s' to update them.", c.Alias, c.Alias)
+				break
+			}
+			m.confirmAlias, m.confirmForget = c.Alias, true
+			m.Message = fmt.Sprintf("Forget the host key of %s? The next connection asks to trust it again. Press y to confirm.", c.Alias)
+
 		case "r":
 			// Reload: Set all current view items to Checking (Blue) and re-trigger
+			var reload tea.Cmd
+			if m.ConfigManager != nil {
+				// Hosts added or changed by the reload are checked once it arrives
+				reload = reloadInventoryCmd(m.ConfigManager, m.commandSources())
+			}
 			if m.ActiveView == ViewServers {
 				for k := range m.ServerStatuses {
 					m.ServerStatuses[k] = ssh.StatusChecking
 				}
-				return m, checkBatch(m.Configs)
+				// Proxies in use are checked again first, their servers follow
+				var upstream []config.HostConfig
+				for _, p := range m.Proxies {
+					if len(m.behind(p.Alias)) > 0 {
+						m.ProxyStatuses[p.Alias] = ssh.StatusChecking
+						upstream = append(upstream, p)
+					}
+				}
+				return m, tea.Batch(checkProxies(upstream), m.checkBatch(m.Configs), reload)
 			} else {
 				for k := range m.ProxyStatuses {
 					m.ProxyStatuses[k] = ssh.StatusChecking
 				}
-				return m, checkBatch(m.Proxies)
+				return m, tea.Batch(checkProxies(m.Proxies), reload)
+			}
+
+		case "i":
+			m.ShowDetails = !m.ShowDetails
+
+		case "s":
+			if m.ActiveView == ViewServers {
+				selected := m.selectedAlias()
+				m.SortByLatency = !m.SortByLatency
+				m.moveCursorTo(selected)
+			}
+
+		case "o":
+			c := m.selectedHost()
+			if c == nil || c.Link == "" {
+				m.Message = "No link configured for this host."
+				break
+			}
+			link := c.Link
+			return m, func() tea.Msg {
+				return openLinkResultMsg{err: config.OpenURL(link)}
 			}
 
 		case "a":
@@ -176,11 +416,58 @@ func (m DashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case PingResultMsg:
+		// Results reorder a sorted list, the cursor stays on its host
+		selected := m.selectedAlias()
+
 		// Update status map
 		if _, ok := m.ServerStatuses[msg.Alias]; ok {
+			m.checked[hostKey{alias: msg.Alias}] = time.Now()
 			m.ServerStatuses[msg.Alias] = msg.Status
-		} else if _, ok := m.ProxyStatuses[msg.Alias]; ok {
-			m.ProxyStatuses[msg.Alias] = msg.Status
+			m.health[msg.Alias] = ssh.ServerHealth(msg)
+		}
+		m.moveCursorTo(selected)
+		return m, nil
+
+	case proxyResultMsg:
+		selected := m.selectedAlias()
+		var cmd tea.Cmd
+		if _, ok := m.ProxyStatuses[msg.alias]; ok {
+			m.checked[hostKey{alias: msg.alias, proxy: true}] = time.Now()
+			m.ProxyStatuses[msg.alias] = msg.status
+			// Now that the proxy is known to be up or down, its servers follow
+			cmd = m.checkBatch(m.behind(msg.alias))
+		}
+		m.moveCursorTo(selected)
+		return m, cmd
+
+	case inventoryMsg:
+		if msg.err != nil {
+			m.Message = fmt.Sprintf("Error reloading config: %v", msg.err)
+			break
+		}
+		m.Warnings = append(msg.inv.Warnings, msg.warnings...)
+		m.StaleSources = nil
+		var changed []config.HostConfig
+		m.Configs, changed = applyInventory(m.Configs, msg.inv.Servers, m.ServerStatuses)
+		var changedProxies []config.HostConfig
+		m.Proxies, changedProxies = applyInventory(m.Proxies, msg.inv.Proxies, m.ProxyStatuses)
+		if n := len(m.currentList()); m.Cursor >= n {
+			m.Cursor = max(n-1, 0)
+		}
+		if m.ConfigManager != nil {
+			m.Findings = m.ConfigManager.Lint(m.Configs, m.Proxies)
+		}
+		// Servers behind a changed proxy are checked again once it has been
+		for _, p := range changedProxies {
+			for _, c := range m.behind(p.Alias) {
+				m.ServerStatuses[c.Alias] = ssh.StatusChecking
+			}
+		}
+		return m, tea.Batch(m.checkBatch(changed), checkProxies(changedProxies))
+
+	case openLinkResultMsg:
+		if msg.err != nil {
+			m.Message = fmt.Sprintf("Error opening link: %v", msg.err)
 		}
 
 	case tea.WindowSizeMsg:
@@ -205,6 +492,9 @@ func (m DashboardModel) View() string {
 	title := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("205")).Render("SSH OGM Dashboard")
 	
 	tabServer := "Servers"
+	if m.SortByLatency {
+		tabServer += " (fastest first)"
+	}
 	tabProxy := "Proxies"
 	
 	activeTabStyle := lipgloss.NewStyle().Border(lipgloss.NormalBorder(), false, false, true, false).BorderForeground(lipgloss.Color("205")).Foreground(lipgloss.Color("205")).Bold(true).Padding(0, 1)
@@ -218,12 +508,20 @@ func (m DashboardModel) View() string {
 		tabProxy = activeTabStyle.Render(tabProxy)
 	}
 
+	if badge := m.lintBadge(); badge != "" {
+		title += "  " + badge
+	}
+
+	for _, w := range m.Warnings {
+		title += "\n" + lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render("! "+w)
+	}
+
 	tabs := lipgloss.JoinHorizontal(lipgloss.Top, tabServer, tabProxy)
 	header := fmt.Sprintf("%s\n\n%s\n", title, tabs)
 	s := header
 	
 	// Content
-	list := m.Configs
+	list := m.servers()
 	statuses := m.ServerStatuses
 	if m.ActiveView == ViewProxies {
 		list = m.Proxies
@@ -252,6 +550,14 @@ func (m DashboardModel) View() string {
 			statusStyle = statusStyle.Foreground(lipgloss.Color("46")) // Green
 		case ssh.StatusOffline:
 			statusStyle = statusStyle.Foreground(lipgloss.Color("196")) // Red
+		case ssh.StatusAuthFailed, ssh.StatusLoginFailed:
+			statusStyle = statusStyle.Foreground(lipgloss.Color("208")) // Orange
+		case ssh.StatusBlocked:
+			statusStyle = statusStyle.Foreground(lipgloss.Color("135")) // Purple
+		case ssh.StatusDegraded:
+			statusStyle = statusStyle.Foreground(lipgloss.Color("220")) // Yellow
+		case ssh.StatusHostKeyMismatch:
+			statusStyle = statusStyle.Foreground(lipgloss.Color("196")) // Red
 		}
 		dot := statusStyle.Render(statusDot)
 		
@@ -259,13 +565,40 @@ func (m DashboardModel) View() string {
 		var details string
 		if m.ActiveView == ViewServers {
 			details = fmt.Sprintf("%s (%s@%s)", c.Alias, c.User, c.Host)
-			if c.Proxy != "" {
-				details += lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Render(fmt.Sprintf(" via %s", c.Proxy))
+			route := m.health[c.Alias].Route
+			if route == "" && c.Proxy != "" {
+				route = "via " + c.Proxy // Not checked yet
+			}
+			if route != "" {
+				details += lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Render(" " + route)
 			}
 		} else {
 			details = fmt.Sprintf("%s (%s:%s %s)", c.Alias, c.Host, c.Port, c.Type)
 		}
 
+		if stat == ssh.StatusAuthFailed {
+			details += statusStyle.Render(" auth failed")
+		}
+		if stat == ssh.StatusLoginFailed {
+			details += statusStyle.Render(" reachable, login fails")
+		}
+		if stat == ssh.StatusDegraded {
+			details += statusStyle.Render(" degraded")
+		}
+		if stat == ssh.StatusHostKeyMismatch {
+			details += statusStyle.Bold(true).Render(" HOST KEY MISMATCH")
+		}
+		if stat == ssh.StatusBlocked {
+			details += statusStyle.Render(" blocked by " + c.Proxy)
+		}
+
+		if sev, ok := m.hostSeverity(c.Alias); ok {
+			details += " " + severityStyle(sev).Render("⚠")
+		}
+
+		if m.ActiveView == ViewServers {
+			dot += " " + m.renderLatency(c.Alias)
+		}
 		row := fmt.Sprintf("%s %s %s", cursor, dot, details)
 		
 		if m.Cursor == i {
@@ -275,7 +608,13 @@ func (m DashboardModel) View() string {
 		}
 	}
 
-	s += "\n(q: quit, r: reload, a: add, tab: switch view)\n"
+	if m.ShowDetails {
+		if c := m.selectedHost(); c != nil {
+			s += "\n" + m.renderDetails(*c) + "\n"
+		}
+	}
+
+	s += "\n(q: quit, r: reload, a: add, p: plain shell, i: details, o: open link, f: forget host key, s: sort by latency, tab: switch view)\n"
 	if m.Message != "" {
 		s += lipgloss.NewStyle().Foreground(lipgloss.Color("205")).Render(m.Message) + "\n"
 	}
@@ -0,0 +1,35 @@
+package tui
+
+import (
+	"ssh-ogm/internal/config"
+	"ssh-ogm/internal/ssh"
+	"testing"
+)
+
+func TestProxySharingServerAlias(t *testing.T) {
+	servers := []config.HostConfig{
+		{Alias: "gw", Host: "10.0.0.1"},
+		{Alias: "app", Host: "10.0.0.2", Proxy: "gw"},
+	}
+	proxies := []config.HostConfig{{Alias: "gw", Host: "proxy.local", Port: "1080"}}
+	m := NewDashboardModel(servers, proxies, nil)
+
+	// The proxy's result must not land on the server named like it
+	next, _ := m.Update(proxyResultMsg{alias: "gw", status: ssh.StatusOffline})
+	m = next.(DashboardModel)
+	if m.ProxyStatuses["gw"] != ssh.StatusOffline || m.ServerStatuses["gw"] != ssh.StatusChecking {
+		t.Errorf("proxy result applied to the server: proxy %s, server %s", m.ProxyStatuses["gw"], m.ServerStatuses["gw"])
+	}
+	if m.ServerStatuses["app"] != ssh.StatusBlocked {
+		t.Errorf("server behind the proxy = %s, want blocked", m.ServerStatuses["app"])
+	}
+
+	next, _ = m.Update(PingResultMsg{Alias: "gw", Status: ssh.StatusOnline})
+	m = next.(DashboardModel)
+	if m.ServerStatuses["gw"] != ssh.StatusOnline || m.ProxyStatuses["gw"] != ssh.StatusOffline {
+		t.Errorf("server result applied to the proxy: proxy %s, server %s", m.ProxyStatuses["gw"], m.ServerStatuses["gw"])
+	}
+	if m.checked[hostKey{alias: "gw"}].IsZero() || m.checked[hostKey{alias: "gw", proxy: true}].IsZero() {
+		t.Errorf("both checks should be recorded: %v", m.checked)
+	}
+}
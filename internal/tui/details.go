@@ -0,0 +1,245 @@
+package tui
+
+import (
+	"fmt"
+	"ssh-ogm/internal/config"
+	"ssh-ogm/internal/ssh"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	detailBoxStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240")).Padding(0, 1)
+	detailLabelStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Width(14)
+)
+
+// findProxy returns the proxy with the given alias, or nil
+func (m DashboardModel) findProxy(alias string) *config.HostConfig {
+	for i := range m.Proxies {
+		if m.Proxies[i].Alias == alias {
+			return &m.Proxies[i]
+		}
+	}
+	return nil
+}
+
+// currentList returns the hosts shown in the active view
+func (m DashboardModel) currentList() []config.HostConfig {
+	if m.ActiveView == ViewProxies {
+		return m.Proxies
+	}
+	return m.servers()
+}
+
+// selectedHost returns the host under the cursor in the active view, or nil
+func (m DashboardModel) selectedHost() *config.HostConfig {
+	list := m.currentList()
+	if m.Cursor < 0 || m.Cursor >= len(list) {
+		return nil
+	}
+	return &list[m.Cursor]
+}
+
+// renderDetails shows every resolved field of c, including defaults the ssh
+// client would apply and the route a connection takes.
+func (m DashboardModel) renderDetails(c config.HostConfig) string {
+	var lines []string
+	add := func(label, value string) {
+		if value == "" {
+			return
+		}
+		lines = append(lines, detailLabelStyle.Render(label)+value)
+	}
+
+	title := lipgloss.NewStyle().Bold(true).Render(c.Alias)
+	if c.Description != "" {
+		title += lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Render(" — " + c.Description)
+	}
+	lines = append(lines, title, "")
+
+	add("Host", c.Host)
+	port := c.Port
+	if port == "" {
+		port = "22 (default)"
+	}
+	add("Port", port)
+
+	if m.ActiveView == ViewProxies {
+		add("Type", c.Type)
+		add("User", c.User)
+		add("Password", describePassword(c))
+	} else {
+		user := c.User
+		if user == "" {
+			user = "(ssh default)"
+		}
+		add("User", user)
+		add("Identity", c.IdentityFile)
+		if c.IdentityCommand != "" {
+			add("Identity", "from command: "+c.IdentityCommand)
+		}
+		add("Route", m.describeRoute(c))
+		if h, ok := m.health[c.Alias]; ok {
+			add("Status", describeHealth(h))
+			if h.Handshake() > 0 {
+				add("Latency", fmt.Sprintf("TCP %s, SSH handshake %s",
+					h.Latency(ssh.StageTCP).Round(time.Millisecond), h.Handshake().Round(time.Millisecond)))
+			}
+			add("Stages", describeStages(h))
+			add("Checks", describeChecks(h))
+			add("Server", h.Banner)
+			add("Algorithms", describeAlgorithms(h.Algorithms))
+			add("Host key", describeHostKey(h))
+		}
+		add("Client", ssh.ClientFor(c))
+		add("Command", c.Command)
+		add("Cwd", c.Cwd)
+		add("Env", strings.Join(c.Env, ", "))
+		add("Send env", strings.Join(c.SendEnv, ", "))
+	}
+
+	for _, f := range m.Findings {
+		if f.About(c.Alias, m.ActiveView == ViewProxies) {
+			lines = append(lines, detailLabelStyle.Render("Security")+severityStyle(f.Severity).Render(f.Severity.String()+" "+f.Message))
+		}
+	}
+
+	add("Tags", strings.Join(c.Tags, ", "))
+	add("Owner", c.Owner)
+	if c.Link != "" {
+		add("Link", c.Link+lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render("  (o: open)"))
+	}
+
+	return detailBoxStyle.Render(strings.Join(lines, "\n"))
+}
+
+// describeRoute explains how a connection to c reaches the host
+func (m DashboardModel) describeRoute(c config.HostConfig) string {
+	if c.Proxy == "" {
+		return "direct"
+	}
+	p := m.findProxy(c.Proxy)
+	if p == nil {
+		return fmt.Sprintf("via %s (not found in proxies.conf)", c.Proxy)
+	}
+	proxyType := p.Type
+	if proxyType == "" {
+		proxyType = "socks5"
+	}
+	return fmt.Sprintf("via %s (%s %s:%s)", p.Alias, proxyType, p.Host, p.Port)
+}
+
+// describeHealth summarises the last check of a server and why it failed
+func describeHealth(h ssh.ServerHealth) string {
+	status := h.Status.String()
+	if h.Class != "" {
+		status += " (" + string(h.Class) + ")"
+	}
+	if h.Error != nil {
+		status += ": " + h.Error.Error()
+	}
+	return status
+}
+
+// describeStages lists how long each stage of the last check took and the
+// stage it failed at, if any
+func describeStages(h ssh.ServerHealth) string {
+	var parts []string
+	for _, t := range h.Timings {
+		parts = append(parts, fmt.Sprintf("%s %s", t.Stage, t.Duration.Round(time.Millisecond)))
+	}
+	if h.Failed != ssh.StageNone {
+		parts = append(parts, lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render(h.Failed.String()+" ✗"))
+	}
+	return strings.Join(parts, " → ")
+}
+
+// describeChecks lists the outcome of each of the host's checks
+func describeChecks(h ssh.ServerHealth) string {
+	var parts []string
+	for _, c := range h.Checks {
+		if c.Status == ssh.StatusOnline {
+			parts = append(parts, c.Name+lipgloss.NewStyle().Foreground(lipgloss.Color("46")).Render(" ✓"))
+		} else {
+			parts = append(parts, c.Name+lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render(" ✗ "+c.Status.String()))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeAlgorithms lists what the key exchange with the server agreed on
+func describeAlgorithms(a *ssh.Negotiated) string {
+	if a == nil {
+		return ""
+	}
+	mac := a.MAC
+	if mac == "" {
+		mac = "implicit"
+	}
+	return fmt.Sprintf("kex %s, host key %s, cipher %s, mac %s", a.KeyExchange, a.HostKey, a.Cipher, mac)
+}
+
+// describeHostKey shows the key the server presented and what known_hosts
+// says about it
+func describeHostKey(h ssh.ServerHealth) string {
+	if h.KeyType == "" {
+		return ""
+	}
+	key := h.KeyType + " " + h.Fingerprint
+	switch h.KeyState {
+	case ssh.HostKeyKnown:
+		return key + " (in known_hosts)"
+	case ssh.HostKeyUnknown:
+		return key + " (not in known_hosts)"
+	case ssh.HostKeyPinned:
+		return key + " (pinned)"
+	case ssh.HostKeyMismatch:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render(key + " (MISMATCH)")
+	}
+	return key + " (known_hosts unreadable)"
+}
+
+// describePassword says where a proxy password comes from without revealing it
+func describePassword(c config.HostConfig) string {
+	switch {
+	case c.PasswordCommand != "":
+		return "from command: " + c.PasswordCommand
+	case strings.HasPrefix(c.Password, config.SecretPrefix):
+		return "vault (" + c.Password + ")"
+	case c.Password != "":
+		return "set (plaintext)"
+	}
+	return ""
+}
+
+// lintBadge summarises the linter findings for the dashboard header
+func (m DashboardModel) lintBadge() string {
+	if len(m.Findings) == 0 {
+		return ""
+	}
+	worst := m.Findings[0].Severity // Sorted most severe first
+	return severityStyle(worst).Render(fmt.Sprintf("⚠ %d security finding(s), run 'mux-ssh lint'", len(m.Findings)))
+}
+
+// hostSeverity returns the most severe finding for the host alias of the
+// active view
+func (m DashboardModel) hostSeverity(alias string) (config.Severity, bool) {
+	for _, f := range m.Findings {
+		if f.About(alias, m.ActiveView == ViewProxies) {
+			return f.Severity, true
+		}
+	}
+	return 0, false
+}
+
+func severityStyle(s config.Severity) lipgloss.Style {
+	switch s {
+	case config.SeverityHigh:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	case config.SeverityWarning:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+}
@@ -0,0 +1,85 @@
+package tui
+
+import (
+	"reflect"
+	"ssh-ogm/internal/config"
+	"ssh-ogm/internal/ssh"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// inventoryMsg carries a freshly loaded inventory
+type inventoryMsg struct {
+	inv      *config.Inventory
+	warnings []string
+	err      error
+}
+
+// reloadInventoryCmd re-runs the given inventory commands and reloads every
+// layer in the background so slow sources never block the dashboard.
+func reloadInventoryCmd(mgr *config.Manager, refresh []string) tea.Cmd {
+	return func() tea.Msg {
+		warnings := mgr.RefreshSources(refresh)
+		inv, err := mgr.LoadInventory()
+		return inventoryMsg{inv: inv, warnings: warnings, err: err}
+	}
+}
+
+// commandSources returns the names of all inventory_command sources
+func (m DashboardModel) commandSources() []string {
+	sources, err := m.ConfigManager.LoadSources()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, src := range sources {
+		if src.Command != "" {
+			names = append(names, src.Name)
+		}
+	}
+	return names
+}
+
+// applyInventory replaces old with updated, keeping the status of hosts whose
+// config did not change. It returns the hosts that need a new check.
+func applyInventory(old, updated []config.HostConfig, statuses map[string]ssh.ServerStatus) ([]config.HostConfig, []config.HostConfig) {
+	previous := make(map[string]config.HostConfig, len(old))
+	for _, h := range old {
+		previous[h.Alias] = h
+	}
+
+	var changed []config.HostConfig
+	seen := make(map[string]bool, len(updated))
+	for _, h := range updated {
+		seen[h.Alias] = true
+		if p, ok := previous[h.Alias]; ok && reflect.DeepEqual(p, h) {
+			continue
+		}
+		statuses[h.Alias] = ssh.StatusChecking
+		changed = append(changed, h)
+	}
+	for alias := range statuses {
+		if !seen[alias] {
+			delete(statuses, alias)
+		}
+	}
+	return updated, changed
+}
+
+// SaveStatuses stores the results of finished health checks so commands like
+// 'mux-ssh export' can report the last known status of each host.
+func (m DashboardModel) SaveStatuses() error {
+	if m.ConfigManager == nil {
+		return nil
+	}
+	finished := func(statuses map[string]ssh.ServerStatus, proxy bool) map[string]config.HostStatus {
+		out := make(map[string]config.HostStatus)
+		for alias, s := range statuses {
+			if s != ssh.StatusChecking {
+				out[alias] = config.HostStatus{Status: s.String(), Checked: m.checked[hostKey{alias, proxy}]}
+			}
+		}
+		return out
+	}
+	return m.ConfigManager.SaveStatuses(finished(m.ServerStatuses, false), finished(m.ProxyStatuses, true))
+}